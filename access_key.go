@@ -0,0 +1,18 @@
+package nex
+
+import "errors"
+
+// ValidateAccessKey checks that the given access key is 8 lowercase alphanumeric characters, as used by NEX titles
+func ValidateAccessKey(accessKey string) error {
+	if len(accessKey) != 8 {
+		return errors.New("[AccessKey] Access key must be 8 characters long")
+	}
+
+	for _, character := range accessKey {
+		if (character < '0' || character > '9') && (character < 'a' || character > 'z') {
+			return errors.New("[AccessKey] Access key must only contain lowercase letters and digits")
+		}
+	}
+
+	return nil
+}
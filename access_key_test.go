@@ -0,0 +1,21 @@
+package nex
+
+import "testing"
+
+func TestValidateAccessKey(t *testing.T) {
+	validKeys := []string{"ridfebb9", "6f599f81", "00000000"}
+
+	for _, accessKey := range validKeys {
+		if err := ValidateAccessKey(accessKey); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", accessKey, err)
+		}
+	}
+
+	invalidKeys := []string{"", "ridfebb", "ridfebb99", "RIDFEBB9", "ridf-bb9", "ridfébb9"}
+
+	for _, accessKey := range invalidKeys {
+		if err := ValidateAccessKey(accessKey); err == nil {
+			t.Errorf("Expected %q to be invalid", accessKey)
+		}
+	}
+}
@@ -1,31 +1,83 @@
 package nex
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
 	"crypto/rc4"
+	"fmt"
+	"hash"
 	"net"
+	"sync"
+	"sync/atomic"
 )
 
 // Client represents a connected or non-connected PRUDP client
 type Client struct {
-	address                   *net.UDPAddr
+	address                   atomic.Value
+	discriminator             string
 	server                    *Server
 	cipher                    *rc4.Cipher
 	decipher                  *rc4.Cipher
 	signatureKey              []byte
+	signatureMAC              hash.Hash
+	signatureMACMutex         sync.Mutex
 	signatureBase             int
 	secureKey                 []byte
 	serverConnectionSignature []byte
 	clientConnectionSignature []byte
-	sessionID                 int
+	sessionID                 uint32
+	hasSessionID              bool
 	sessionKey                []byte
+	pid                       atomic.Value
+	connectionID              uint32
 	sequenceIDIn              *Counter
 	sequenceIDOut             *Counter
+	sequenceIDStart           uint16
+	heldPackets               map[uint16]PacketInterface
+	fragments                 []byte
+	droppingFragments         bool
+	reliableMutex             sync.Mutex
+	fragmentSize              int16
+	resendScheduler           *ResendScheduler
+	connectRequest            []byte
+	connectResponse           []byte
+	connectMutex              sync.Mutex
+	connected                 int32
+	pingTimer                 *clockTimer
+	pingSent                  bool
+	pingMutex                 sync.Mutex
+	sendMutex                 sync.Mutex
+	userData                  interface{}
+	userDataMutex             sync.Mutex
 }
 
 // Reset resets the Client to default values
 func (client *Client) Reset() {
+	client.reliableMutex.Lock()
 	client.sequenceIDIn = NewCounter(0)
-	client.sequenceIDOut = NewCounter(0)
+	client.heldPackets = make(map[uint16]PacketInterface)
+	client.fragments = nil
+	client.droppingFragments = false
+	client.reliableMutex.Unlock()
+
+	// Sends may be running on handler goroutines, and use the sequence IDs, resend scheduler, session ID and keys reset here
+	// while holding the send lock
+	client.sendMutex.Lock()
+	defer client.sendMutex.Unlock()
+
+	client.resetSequenceIDOut()
+
+	if client.resendScheduler != nil {
+		client.resendScheduler.Stop()
+	}
+
+	client.resendScheduler = NewResendScheduler(client)
+	client.setConnectResponse(nil, nil)
+	atomic.StoreUint32(&client.sessionID, 0)
+	client.hasSessionID = false
+	atomic.StoreInt32(&client.connected, 0)
+	client.SetUserData(nil)
 
 	client.UpdateAccessKey(client.Server().AccessKey())
 	client.UpdateRC4Key([]byte("CD&ML"))
@@ -41,7 +93,153 @@ func (client *Client) Reset() {
 
 // Address returns the clients UDP address
 func (client *Client) Address() *net.UDPAddr {
-	return client.address
+	address, _ := client.address.Load().(*net.UDPAddr)
+
+	return address
+}
+
+// setAddress updates the clients UDP address when it sends from a new address. The address is read by other goroutines
+// sending to the client while datagrams are being received, so it is stored atomically
+func (client *Client) setAddress(address *net.UDPAddr) {
+	if address != nil {
+		client.address.Store(address)
+	}
+}
+
+// Discriminator returns the key the client is stored under on the server
+func (client *Client) Discriminator() string {
+	return client.discriminator
+}
+
+// setConnectResponse caches the response payload sent in the acknowledgement of the given CONNECT payload.
+// The acknowledgement is sent from its own goroutine while CONNECTs are received, so the cache is guarded by a lock
+func (client *Client) setConnectResponse(request []byte, response []byte) {
+	client.connectMutex.Lock()
+	defer client.connectMutex.Unlock()
+
+	client.connectRequest = request
+	client.connectResponse = response
+}
+
+// cachedConnectResponse returns the response payload cached for the given CONNECT payload, or nil if it was not answered yet
+func (client *Client) cachedConnectResponse(request []byte) []byte {
+	client.connectMutex.Lock()
+	defer client.connectMutex.Unlock()
+
+	if client.connectResponse == nil || !bytes.Equal(client.connectRequest, request) {
+		return nil
+	}
+
+	return client.connectResponse
+}
+
+// SetSessionID sets the PRUDP session ID negotiated with the client in the CONNECT packet
+func (client *Client) SetSessionID(sessionID uint8) {
+	client.sendMutex.Lock()
+	defer client.sendMutex.Unlock()
+
+	atomic.StoreUint32(&client.sessionID, uint32(sessionID))
+	client.hasSessionID = true
+}
+
+// SessionID returns the PRUDP session ID negotiated with the client.
+// It is stored atomically as it is read when logging the client, which can happen from any goroutine
+func (client *Client) SessionID() uint8 {
+	return uint8(atomic.LoadUint32(&client.sessionID))
+}
+
+// SetPID sets the PID of the user the client is authenticated as, making the client available through Server.ClientByPID.
+// Titles send the PID in the Kerberos ticket of the secure server CONNECT, so this is set by the application. A nil or 0 PID clears it
+func (client *Client) SetPID(pid *PID) {
+	client.Server().setClientPID(client, pid)
+}
+
+// PID returns the PID of the user the client is authenticated as, or nil if it has not been set
+func (client *Client) PID() *PID {
+	pid, _ := client.pid.Load().(*PID)
+
+	return pid
+}
+
+// pidValue returns the value of the client PID, or 0 if it has not been set
+func (client *Client) pidValue() uint64 {
+	if pid := client.PID(); pid != nil {
+		return pid.Value()
+	}
+
+	return 0
+}
+
+// ConnectionID returns the connection ID the server assigned to the client when it connected, or 0 if it has not connected.
+// Like the session ID, it is stored atomically as the client can be logged from any goroutine
+func (client *Client) ConnectionID() uint32 {
+	return atomic.LoadUint32(&client.connectionID)
+}
+
+// SetUserData stores application data with the client, such as account info for the authenticated user.
+// The data is cleared when the client is reset by a new handshake or kicked. Only the storage slot is safe for concurrent use,
+// synchronizing access to the stored value itself is up to the caller
+func (client *Client) SetUserData(userData interface{}) {
+	client.userDataMutex.Lock()
+	defer client.userDataMutex.Unlock()
+
+	client.userData = userData
+}
+
+// UserData returns the application data stored with SetUserData, or nil if none is set
+func (client *Client) UserData() interface{} {
+	client.userDataMutex.Lock()
+	defer client.userDataMutex.Unlock()
+
+	return client.userData
+}
+
+// resetPingTimer restarts the ping timeout after a packet is received from the client
+func (client *Client) resetPingTimer() {
+	timeout := client.Server().PingTimeout()
+
+	if timeout <= 0 {
+		return
+	}
+
+	client.pingMutex.Lock()
+	defer client.pingMutex.Unlock()
+
+	client.pingSent = false
+
+	if client.pingTimer == nil {
+		client.pingTimer = newClockTimer(client.Server(), timeout, client.pingTimeout)
+	} else {
+		client.pingTimer.Reset(timeout)
+	}
+}
+
+// pingTimeout pings the client the first time it times out, and kicks it if it times out again without sending anything
+func (client *Client) pingTimeout() {
+	client.pingMutex.Lock()
+
+	if !client.pingSent {
+		client.pingSent = true
+		client.pingTimer.Reset(client.Server().PingTimeout())
+		client.pingMutex.Unlock()
+
+		client.Server().SendPing(client)
+		return
+	}
+
+	client.pingMutex.Unlock()
+
+	client.Server().timeoutClient(client)
+}
+
+// stopPingTimer stops the ping timeout once the client is removed from the server
+func (client *Client) stopPingTimer() {
+	client.pingMutex.Lock()
+	defer client.pingMutex.Unlock()
+
+	if client.pingTimer != nil {
+		client.pingTimer.Stop()
+	}
 }
 
 // Server returns the server the client is currently connected to
@@ -70,8 +268,27 @@ func (client *Client) Decipher() *rc4.Cipher {
 
 // UpdateAccessKey sets the client signature base and signature key
 func (client *Client) UpdateAccessKey(accessKey string) {
+	client.signatureMACMutex.Lock()
+	defer client.signatureMACMutex.Unlock()
+
 	client.signatureBase = sum([]byte(accessKey))
 	client.signatureKey = MD5Hash([]byte(accessKey))
+	client.signatureMAC = hmac.New(md5.New, client.signatureKey)
+}
+
+// calculateHMAC returns the HMAC-MD5 of the given data keyed with the clients signature key.
+// The hash is created once per signature key and reset between packets instead of being recreated for each one
+func (client *Client) calculateHMAC(data ...[]byte) []byte {
+	client.signatureMACMutex.Lock()
+	defer client.signatureMACMutex.Unlock()
+
+	client.signatureMAC.Reset()
+
+	for _, part := range data {
+		client.signatureMAC.Write(part)
+	}
+
+	return client.signatureMAC.Sum(nil)
 }
 
 // SignatureBase returns the v0 checksum signature base
@@ -109,11 +326,37 @@ func (client *Client) SequenceIDCounterOut() *Counter {
 	return client.sequenceIDOut
 }
 
+// SetSequenceIDStart sets the sequence ID of the next packet sent to the client, and of the first packet sent after each Reset.
+// This is mainly useful for getting deterministic packets in tests. The default start is 1
+func (client *Client) SetSequenceIDStart(sequenceID uint16) {
+	client.sendMutex.Lock()
+	defer client.sendMutex.Unlock()
+
+	client.sequenceIDStart = sequenceID
+	client.resetSequenceIDOut()
+}
+
+// resetSequenceIDOut resets the out-going sequence ID counter so the next packet uses the sequence ID start. The send lock must be held
+func (client *Client) resetSequenceIDOut() {
+	// The counter is incremented before each use, and the value is truncated to 16 bits when used
+	client.sequenceIDOut = NewCounter(uint64(client.sequenceIDStart - 1))
+}
+
 // SequenceIDCounterIn returns the clients packet SequenceID counter for incoming packets
 func (client *Client) SequenceIDCounterIn() *Counter {
 	return client.sequenceIDIn
 }
 
+// ResendScheduler returns the scheduler resending the clients unacknowledged reliable packets
+func (client *Client) ResendScheduler() *ResendScheduler {
+	return client.resendScheduler
+}
+
+// ResendAllPending resends all of the clients unacknowledged reliable packets immediately, such as after its address changed
+func (client *Client) ResendAllPending() {
+	client.ResendScheduler().ResendAll()
+}
+
 // SetSessionKey sets the clients session key
 func (client *Client) SetSessionKey(sessionKey []byte) {
 	client.sessionKey = sessionKey
@@ -124,13 +367,38 @@ func (client *Client) SessionKey() []byte {
 	return client.sessionKey
 }
 
+// SetFragmentSize sets the maximum payload size of each fragment sent to the client. A size of 0 or less uses the server default
+func (client *Client) SetFragmentSize(fragmentSize int16) {
+	if fragmentSize < 0 {
+		fragmentSize = 0
+	}
+
+	client.fragmentSize = fragmentSize
+}
+
+// FragmentSize returns the maximum payload size of each fragment sent to the client
+func (client *Client) FragmentSize() int16 {
+	if client.fragmentSize > 0 {
+		return client.fragmentSize
+	}
+
+	return client.Server().FragmentSize()
+}
+
+// String returns a compact description of the client for logging
+func (client *Client) String() string {
+	return fmt.Sprintf("Client{address: %s, sessionID: %d, pid: %d, connectionID: %d, connected: %t}",
+		client.Address(), client.SessionID(), client.pidValue(), client.ConnectionID(), atomic.LoadInt32(&client.connected) == 1)
+}
+
 // NewClient returns a new PRUDP client
 func NewClient(address *net.UDPAddr, server *Server) *Client {
 	client := &Client{
-		address: address,
-		server:  server,
+		server:          server,
+		sequenceIDStart: 1,
 	}
 
+	client.setAddress(address)
 	client.Reset()
 
 	return client
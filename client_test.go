@@ -0,0 +1,101 @@
+package nex
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClientString(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	serverClient := client.client
+	serverClient.SetPID(NewPID(1234567890123))
+
+	expected := fmt.Sprintf("Client{address: %s, sessionID: 42, pid: 1234567890123, connectionID: %d, connected: true}",
+		client.conn.LocalAddr(), serverClient.ConnectionID())
+
+	if serverClient.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, serverClient.String())
+	}
+
+	if serverClient.ConnectionID() == 0 {
+		t.Error("Connected client has no connection ID")
+	}
+}
+
+func TestClientStringWhileKicked(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	done := make(chan struct{})
+
+	// Logging the client from another goroutine while it is kicked, which the race detector checks
+	go func() {
+		defer close(done)
+
+		for i := 0; i < 100; i++ {
+			_ = client.client.String()
+		}
+	}()
+
+	server.Kick(client.client)
+	<-done
+
+	if client.client.ConnectionID() != 0 {
+		t.Errorf("Expected the kicked client to have no connection ID, got %d", client.client.ConnectionID())
+	}
+}
+
+func TestClientFragmentSize(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetFragmentSize(512)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	// Clients use the server default until a size is negotiated for them
+	if size := client.client.FragmentSize(); size != 512 {
+		t.Errorf("Expected the server fragment size 512 after connect, got %d", size)
+	}
+
+	client.client.SetFragmentSize(256)
+
+	if size := client.client.FragmentSize(); size != 256 {
+		t.Errorf("Expected the client fragment size 256, got %d", size)
+	}
+
+	client.client.SetFragmentSize(0)
+
+	if size := client.client.FragmentSize(); size != 512 {
+		t.Errorf("Expected a fragment size of 0 to fall back to 512, got %d", size)
+	}
+}
+
+func TestClientSequenceIDStart(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	client.client.SetSequenceIDStart(500)
+
+	for _, expected := range []uint16{500, 501} {
+		packet, _ := NewPacketV1(client.client, nil)
+		packet.SetSource(0xA1)
+		packet.SetDestination(0xAF)
+		packet.SetType(DataPacket)
+		packet.SetPayload([]byte{0x01})
+
+		server.SendReliable(packet, nil, nil)
+
+		if sequenceID := client.receive().SequenceID(); sequenceID != expected {
+			t.Errorf("Expected sequence ID %d, got %d", expected, sequenceID)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package nex
+
+import (
+	"sync"
+	"time"
+)
+
+// clockTimer calls a function once a duration has passed on the server clock.
+// It waits on the system clock, and if the server clock has not reached the deadline by then it waits again for the time remaining.
+// A server clock which is stopped or running behind delays the timer, and one which has been advanced fires it the next time it wakes up
+type clockTimer struct {
+	sync.Mutex
+	server   *Server
+	timer    *time.Timer
+	deadline time.Time
+	stopped  bool
+	function func()
+}
+
+// Reset restarts the timer so it fires once the duration has passed on the server clock
+func (timer *clockTimer) Reset(duration time.Duration) {
+	timer.Lock()
+	defer timer.Unlock()
+
+	timer.deadline = timer.server.Now().Add(duration)
+	timer.stopped = false
+
+	if timer.timer == nil {
+		timer.timer = time.AfterFunc(duration, timer.fire)
+	} else {
+		timer.timer.Reset(duration)
+	}
+}
+
+// Stop stops the timer from firing
+func (timer *clockTimer) Stop() {
+	timer.Lock()
+	defer timer.Unlock()
+
+	timer.stopped = true
+	timer.timer.Stop()
+}
+
+func (timer *clockTimer) fire() {
+	timer.Lock()
+
+	if timer.stopped {
+		timer.Unlock()
+		return
+	}
+
+	if remaining := timer.deadline.Sub(timer.server.Now()); remaining > 0 {
+		// Not yet due on the server clock, or restarted while the system timer was firing
+		timer.timer.Reset(remaining)
+		timer.Unlock()
+		return
+	}
+
+	timer.stopped = true
+	timer.Unlock()
+
+	timer.function()
+}
+
+// newClockTimer returns a clockTimer which calls the function once the duration has passed on the server clock
+func newClockTimer(server *Server, duration time.Duration, function func()) *clockTimer {
+	timer := &clockTimer{
+		server:   server,
+		function: function,
+	}
+
+	timer.Reset(duration)
+
+	return timer
+}
@@ -0,0 +1,94 @@
+package nex
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// testClock is a server clock which only moves when advanced by the test
+type testClock struct {
+	sync.Mutex
+	now time.Time
+}
+
+func (clock *testClock) Now() time.Time {
+	clock.Lock()
+	defer clock.Unlock()
+
+	return clock.now
+}
+
+func (clock *testClock) Advance(duration time.Duration) {
+	clock.Lock()
+	defer clock.Unlock()
+
+	clock.now = clock.now.Add(duration)
+}
+
+func newTestClock() *testClock {
+	return &testClock{now: time.Unix(1700000000, 0)}
+}
+
+func TestClockTimerFollowsServerClock(t *testing.T) {
+	clock := newTestClock()
+
+	server := NewServer()
+	server.SetClock(clock.Now)
+
+	fired := make(chan struct{})
+
+	newClockTimer(server, 20*time.Millisecond, func() {
+		close(fired)
+	})
+
+	// The system clock passes the deadline several times, but the server clock has not moved
+	select {
+	case <-fired:
+		t.Fatal("Timer fired before the server clock reached its deadline")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	clock.Advance(20 * time.Millisecond)
+
+	select {
+	case <-fired:
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the timer to fire after the server clock was advanced")
+	}
+}
+
+func TestReconnectionWindowFollowsServerClock(t *testing.T) {
+	clock := newTestClock()
+
+	server := newTestServer(t, func(server *Server) {
+		server.SetClock(clock.Now)
+		server.SetReconnectionWindow(time.Minute)
+	})
+
+	for _, test := range []struct {
+		elapsed  time.Duration
+		restored bool
+	}{
+		{30 * time.Second, true},
+		{2 * time.Minute, false},
+	} {
+		pid := NewPID(uint64(test.elapsed / time.Second))
+
+		client := newTestClient(t, server)
+		client.connect(nil)
+		client.client.SetPID(pid)
+		client.client.SetUserData("state")
+
+		server.Kick(client.client)
+		clock.Advance(test.elapsed)
+
+		reconnected := newTestClient(t, server)
+		reconnected.connect(nil)
+		reconnected.client.SetPID(pid)
+
+		if restored := reconnected.client.UserData() == "state"; restored != test.restored {
+			t.Errorf("After %s: expected restored to be %t, got %t", test.elapsed, test.restored, restored)
+		}
+	}
+}
@@ -1,5 +1,18 @@
 package nex
 
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io/ioutil"
+)
+
+// CompressionAlgorithm compresses outgoing and decompresses incoming DATA packet payloads
+type CompressionAlgorithm interface {
+	Compress(data []byte) []byte
+	Decompress(data []byte) ([]byte, error)
+}
+
 // DummyCompression represents no compression
 type DummyCompression struct{}
 
@@ -9,19 +22,97 @@ func (compression *DummyCompression) Compress(data []byte) []byte {
 }
 
 // Decompress returns the data as-is
-func (compression *DummyCompression) Decompress(data []byte) []byte {
-	return data
+func (compression *DummyCompression) Decompress(data []byte) ([]byte, error) {
+	return data, nil
 }
 
-// ZLibCompression represents ZLib compression
+// ZLibCompression represents ZLib compression.
+// The compressed data is prefixed with a byte holding the compression ratio, rounded up. A ratio of 0 means the data is not compressed
 type ZLibCompression struct{}
 
-// Compress returns the data as-is (needs to be updated to return ZLib compressed data)
+// Compress returns the ZLib compressed data with the compression ratio prefix. Data which does not get smaller,
+// or compresses with a ratio too large for the prefix byte, is sent uncompressed
 func (compression *ZLibCompression) Compress(data []byte) []byte {
-	return data
+	if len(data) == 0 {
+		return data
+	}
+
+	var compressed bytes.Buffer
+
+	writer := zlib.NewWriter(&compressed)
+	_, err := writer.Write(data)
+
+	if err == nil {
+		err = writer.Close()
+	}
+
+	if err != nil || compressed.Len() >= len(data) {
+		return append([]byte{0}, data...)
+	}
+
+	ratio := len(data) / compressed.Len()
+
+	if len(data)%compressed.Len() != 0 {
+		ratio++
+	}
+
+	// The ratio has to fit in the prefix byte, clients size their decompression buffer from it
+	if ratio > 0xFF {
+		return append([]byte{0}, data...)
+	}
+
+	return append([]byte{byte(ratio)}, compressed.Bytes()...)
 }
 
-// Decompress returns the data as-is (needs to be updated to return ZLib decompressed data)
-func (compression *ZLibCompression) Decompress(data []byte) []byte {
-	return data
+// Decompress returns the ZLib decompressed data, skipping the compression ratio prefix
+func (compression *ZLibCompression) Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	if data[0] == 0 {
+		return data[1:], nil
+	}
+
+	reader, err := zlib.NewReader(bytes.NewReader(data[1:]))
+
+	if err != nil {
+		return nil, errors.New("[ZLibCompression] " + err.Error())
+	}
+
+	defer reader.Close()
+
+	decompressed, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		return nil, errors.New("[ZLibCompression] " + err.Error())
+	}
+
+	return decompressed, nil
+}
+
+// DummyZLibCompression represents the ZLib payload format without any compression.
+// Data is always sent with a compression ratio prefix of 0, as some titles expect
+type DummyZLibCompression struct{}
+
+// Compress returns the data prefixed with a compression ratio of 0
+func (compression *DummyZLibCompression) Compress(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+
+	return append([]byte{0}, data...)
+}
+
+// Decompress returns the data without the compression ratio prefix
+func (compression *DummyZLibCompression) Decompress(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+
+	if data[0] != 0 {
+		return nil, errors.New("[DummyZLibCompression] Data is compressed")
+	}
+
+	return data[1:], nil
 }
@@ -1,19 +1,25 @@
 package nex
 
-// Counter represents an incremental counter
+import "sync/atomic"
+
+// Counter represents an incremental counter. All methods are safe for concurrent use
 type Counter struct {
 	value uint64
 }
 
-// Value returns the counters current value
-func (counter Counter) Value() uint64 {
-	return counter.value
+// Value returns the counters current value without incrementing it
+func (counter *Counter) Value() uint64 {
+	return atomic.LoadUint64(&counter.value)
 }
 
 // Increment increments the counter by 1 and returns the value
 func (counter *Counter) Increment() uint64 {
-	counter.value++
-	return counter.Value()
+	return atomic.AddUint64(&counter.value, 1)
+}
+
+// Reset sets the counters current value, so the next Increment returns value + 1
+func (counter *Counter) Reset(value uint64) {
+	atomic.StoreUint64(&counter.value, value)
 }
 
 // NewCounter returns a new Counter, with a starting number
@@ -21,4 +27,4 @@ func NewCounter(start uint64) *Counter {
 	counter := &Counter{value: start}
 
 	return counter
-}
\ No newline at end of file
+}
@@ -0,0 +1,50 @@
+package nex
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestCounterConcurrentUse(t *testing.T) {
+	counter := NewCounter(10)
+
+	if counter.Value() != 10 || counter.Increment() != 11 || counter.Value() != 11 {
+		t.Fatal("Counter did not start at 10 and increment to 11")
+	}
+
+	counter.Reset(0)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			for j := 0; j < 1000; j++ {
+				switch {
+				case i == 0 && j%250 == 0:
+					counter.Reset(0)
+				case i%2 == 0:
+					counter.Value()
+				default:
+					counter.Increment()
+				}
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	// Only the increments after the last reset are counted, so the value is at most the total number of increments
+	if value := counter.Value(); value > 4000 {
+		t.Errorf("Expected at most 4000 increments to be counted, got %d", value)
+	}
+
+	counter.Reset(41)
+
+	if counter.Increment() != 42 {
+		t.Error("Expected the next increment after resetting to 41 to return 42")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/rc4"
+	"errors"
 	"fmt"
 )
 
@@ -17,7 +18,7 @@ type KerberosEncryption struct {
 // Ticket represents a Kerberos authentication ticket
 type Ticket struct {
 	sessionKey []byte
-	serverPID  uint32
+	serverPID  *PID
 	ticketData []byte
 }
 
@@ -30,10 +31,215 @@ type TicketData struct {
 // TicketInfo contains the actual data of the ticket
 type TicketInfo struct {
 	datetime   uint64
-	userPID    uint32
+	userPID    *PID
 	sessionKey []byte
 }
 
+// SetSessionKey sets the Ticket session key
+func (ticket *Ticket) SetSessionKey(sessionKey []byte) {
+	ticket.sessionKey = sessionKey
+}
+
+// SessionKey returns the Ticket session key
+func (ticket *Ticket) SessionKey() []byte {
+	return ticket.sessionKey
+}
+
+// SetServerPID sets the Ticket server PID
+func (ticket *Ticket) SetServerPID(serverPID *PID) {
+	ticket.serverPID = serverPID
+}
+
+// ServerPID returns the Ticket server PID
+func (ticket *Ticket) ServerPID() *PID {
+	return ticket.serverPID
+}
+
+// SetTicketData sets the Ticket encrypted ticket data
+func (ticket *Ticket) SetTicketData(ticketData []byte) {
+	ticket.ticketData = ticketData
+}
+
+// TicketData returns the Ticket encrypted ticket data
+func (ticket *Ticket) TicketData() []byte {
+	return ticket.ticketData
+}
+
+// SetTicketKey sets the TicketData key used for deriving the TicketInfo encryption key
+func (ticketData *TicketData) SetTicketKey(ticketKey []byte) {
+	ticketData.ticketKey = ticketKey
+}
+
+// TicketKey returns the TicketData key used for deriving the TicketInfo encryption key
+func (ticketData *TicketData) TicketKey() []byte {
+	return ticketData.ticketKey
+}
+
+// SetTicketInfo sets the TicketData encrypted TicketInfo
+func (ticketData *TicketData) SetTicketInfo(ticketInfo []byte) {
+	ticketData.ticketInfo = ticketInfo
+}
+
+// TicketInfo returns the TicketData encrypted TicketInfo
+func (ticketData *TicketData) TicketInfo() []byte {
+	return ticketData.ticketInfo
+}
+
+// SetDateTime sets the TicketInfo issue time, as a DateTime value
+func (ticketInfo *TicketInfo) SetDateTime(datetime uint64) {
+	ticketInfo.datetime = datetime
+}
+
+// DateTime returns the TicketInfo issue time, as a DateTime value
+func (ticketInfo *TicketInfo) DateTime() uint64 {
+	return ticketInfo.datetime
+}
+
+// SetUserPID sets the TicketInfo user PID
+func (ticketInfo *TicketInfo) SetUserPID(userPID *PID) {
+	ticketInfo.userPID = userPID
+}
+
+// UserPID returns the TicketInfo user PID
+func (ticketInfo *TicketInfo) UserPID() *PID {
+	return ticketInfo.userPID
+}
+
+// SetSessionKey sets the TicketInfo session key
+func (ticketInfo *TicketInfo) SetSessionKey(sessionKey []byte) {
+	ticketInfo.sessionKey = sessionKey
+}
+
+// SessionKey returns the TicketInfo session key
+func (ticketInfo *TicketInfo) SessionKey() []byte {
+	return ticketInfo.sessionKey
+}
+
+// Encrypt returns the Ticket encrypted with the given key. The Ticket is written to a new stream using the server of the given stream,
+// so the server PID is written as a 32-bit or 64-bit PID depending on it (see StreamOut.WritePID). An unset server PID is written as 0
+func (ticket *Ticket) Encrypt(key []byte, stream *StreamOut) []byte {
+	ticketStream := NewStreamOut(stream.Server)
+
+	ticketStream.Grow(int64(len(ticket.sessionKey)))
+	ticketStream.WriteBytesNext(ticket.sessionKey)
+	writeKerberosPID(ticketStream, ticket.serverPID)
+	ticketStream.WriteBuffer(ticket.ticketData)
+
+	return NewKerberosEncryption(key).Encrypt(ticketStream.Bytes())
+}
+
+// Decrypt decrypts the Ticket in the stream with the given key and reads it.
+// The session key is read with the size set by Server.SetKerberosKeySize, or 32 bytes if the stream has no server
+func (ticket *Ticket) Decrypt(stream *StreamIn, key []byte) error {
+	decrypted, err := decryptKerberos(stream, key)
+
+	if err != nil {
+		return err
+	}
+
+	keySize := kerberosKeySize(stream.Server)
+
+	err = decrypted.checkRemaining("Ticket", int64(keySize))
+
+	if err != nil {
+		return err
+	}
+
+	ticket.sessionKey = decrypted.ReadBytesNext(int64(keySize))
+
+	err = decrypted.checkRemaining("Ticket", pidSize(stream.Server))
+
+	if err != nil {
+		return err
+	}
+
+	ticket.serverPID = decrypted.ReadPID()
+	ticket.ticketData, err = decrypted.ReadBuffer()
+
+	return err
+}
+
+// Encrypt returns the TicketInfo encrypted with the given key. The TicketInfo is written to a new stream using the server of the given stream,
+// so the user PID is written as a 32-bit or 64-bit PID depending on it (see StreamOut.WritePID). An unset user PID is written as 0
+func (ticketInfo *TicketInfo) Encrypt(key []byte, stream *StreamOut) []byte {
+	ticketInfoStream := NewStreamOut(stream.Server)
+
+	ticketInfoStream.WriteUInt64LE(ticketInfo.datetime)
+	writeKerberosPID(ticketInfoStream, ticketInfo.userPID)
+	ticketInfoStream.Grow(int64(len(ticketInfo.sessionKey)))
+	ticketInfoStream.WriteBytesNext(ticketInfo.sessionKey)
+
+	return NewKerberosEncryption(key).Encrypt(ticketInfoStream.Bytes())
+}
+
+// Decrypt decrypts the TicketInfo in the stream with the given key and reads it.
+// The session key is read with the size set by Server.SetKerberosKeySize, or 32 bytes if the stream has no server
+func (ticketInfo *TicketInfo) Decrypt(stream *StreamIn, key []byte) error {
+	decrypted, err := decryptKerberos(stream, key)
+
+	if err != nil {
+		return err
+	}
+
+	keySize := kerberosKeySize(stream.Server)
+
+	err = decrypted.checkRemaining("TicketInfo", 8+pidSize(stream.Server)+int64(keySize))
+
+	if err != nil {
+		return err
+	}
+
+	ticketInfo.datetime = decrypted.ReadUInt64LE()
+	ticketInfo.userPID = decrypted.ReadPID()
+	ticketInfo.sessionKey = decrypted.ReadBytesNext(int64(keySize))
+
+	return nil
+}
+
+// decryptKerberos decrypts the rest of the stream with the given key, returning a stream over the decrypted data
+func decryptKerberos(stream *StreamIn, key []byte) (*StreamIn, error) {
+	data := stream.Bytes()[stream.ByteOffset():]
+
+	if len(data) < md5.Size {
+		return nil, errors.New("[Kerberos] Encrypted data is shorter than the checksum")
+	}
+
+	encryption := NewKerberosEncryption(key)
+
+	if !encryption.Validate(data) {
+		return nil, errors.New("[Kerberos] Invalid checksum")
+	}
+
+	return NewStreamIn(encryption.Decrypt(data), stream.Server), nil
+}
+
+// writeKerberosPID writes a ticket PID, or 0 if it is not set
+func writeKerberosPID(stream *StreamOut, pid *PID) {
+	if pid == nil {
+		pid = NewLegacyPID(0)
+	}
+
+	stream.WritePID(pid)
+}
+
+// kerberosKeySize returns the session key size of the server, or 32 bytes if there is no server
+func kerberosKeySize(server *Server) int {
+	if server == nil {
+		return 32
+	}
+
+	return server.KerberosKeySize()
+}
+
+// pidSize returns the number of bytes a PID is encoded as for the server
+func pidSize(server *Server) int64 {
+	if Uses64BitPIDs(server) {
+		return 8
+	}
+
+	return 4
+}
+
 // Encrypt will encrypt the given data using Kerberos
 func (encryption *KerberosEncryption) Encrypt(buffer []byte) []byte {
 	encrypted := make([]byte, len(buffer))
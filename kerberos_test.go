@@ -0,0 +1,119 @@
+package nex
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKerberosTicketWith64BitPID(t *testing.T) {
+	server := NewServer()
+	server.SetNexVersion(4)
+	server.SetKerberosKeySize(16)
+
+	sessionKey := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F}
+	serverKey := []byte("server key")
+	userKey := []byte("user key")
+
+	ticketInfo := &TicketInfo{}
+	ticketInfo.SetDateTime(NewDateTimeFromTime(server.Now()).Value())
+	ticketInfo.SetUserPID(NewPID(0x100000002))
+	ticketInfo.SetSessionKey(sessionKey)
+
+	ticket := &Ticket{}
+	ticket.SetSessionKey(sessionKey)
+	ticket.SetServerPID(NewPID(0x200000001))
+	ticket.SetTicketData(ticketInfo.Encrypt(serverKey, NewStreamOut(server)))
+
+	encrypted := ticket.Encrypt(userKey, NewStreamOut(server))
+
+	// What the client decrypts with its key
+	decryptedTicket := &Ticket{}
+
+	if err := decryptedTicket.Decrypt(NewStreamIn(encrypted, server), userKey); err != nil {
+		t.Fatalf("Failed to decrypt the ticket: %v", err)
+	}
+
+	if !bytes.Equal(decryptedTicket.SessionKey(), sessionKey) || decryptedTicket.ServerPID().Value() != 0x200000001 {
+		t.Errorf("Unexpected ticket: session key % X server PID %s", decryptedTicket.SessionKey(), decryptedTicket.ServerPID())
+	}
+
+	// What the secure server decrypts with its key
+	decryptedInfo := &TicketInfo{}
+
+	if err := decryptedInfo.Decrypt(NewStreamIn(decryptedTicket.TicketData(), server), serverKey); err != nil {
+		t.Fatalf("Failed to decrypt the ticket info: %v", err)
+	}
+
+	if decryptedInfo.UserPID().Value() != 0x100000002 || !decryptedInfo.UserPID().Is64Bit() {
+		t.Errorf("Expected 64-bit user PID %d, got %s", uint64(0x100000002), decryptedInfo.UserPID())
+	}
+
+	if decryptedInfo.DateTime() != ticketInfo.DateTime() || !bytes.Equal(decryptedInfo.SessionKey(), sessionKey) {
+		t.Errorf("Unexpected ticket info: datetime %X session key % X", decryptedInfo.DateTime(), decryptedInfo.SessionKey())
+	}
+
+	if err := (&TicketInfo{}).Decrypt(NewStreamIn(decryptedTicket.TicketData(), server), userKey); err == nil {
+		t.Error("Expected an error decrypting the ticket info with the wrong key")
+	}
+}
+
+func TestKerberosTicketLegacyPID(t *testing.T) {
+	server := NewServer()
+	server.SetNexVersion(3)
+	server.SetKerberosKeySize(16)
+
+	ticketInfo := &TicketInfo{}
+	ticketInfo.SetUserPID(NewLegacyPID(1750000000))
+	ticketInfo.SetSessionKey(make([]byte, 16))
+
+	// 8 byte datetime, 4 byte PID and 16 byte session key, followed by the checksum
+	encrypted := ticketInfo.Encrypt([]byte("server key"), NewStreamOut(server))
+
+	if len(encrypted) != 8+4+16+16 {
+		t.Errorf("Expected a %d byte ticket info with a 32-bit PID, got %d bytes", 8+4+16+16, len(encrypted))
+	}
+
+	decrypted := &TicketInfo{}
+
+	if err := decrypted.Decrypt(NewStreamIn(encrypted, server), []byte("server key")); err != nil {
+		t.Fatalf("Failed to decrypt the ticket info: %v", err)
+	}
+
+	if decrypted.UserPID().Value() != 1750000000 || decrypted.UserPID().Is64Bit() {
+		t.Errorf("Expected 32-bit user PID 1750000000, got %s", decrypted.UserPID())
+	}
+}
+
+func TestKerberosTicketWithoutPID(t *testing.T) {
+	// Data already written to the stream is not part of the ticket
+	stream := NewStreamOut(nil)
+	stream.WriteUInt32LE(0xFFFFFFFF)
+
+	// Only the session key is set
+	ticket := &Ticket{}
+	ticket.SetSessionKey(make([]byte, 32))
+
+	encrypted := ticket.Encrypt([]byte("user key"), stream)
+
+	// 32 byte session key, 4 byte PID and an empty buffer, followed by the checksum
+	if len(encrypted) != 32+4+4+16 {
+		t.Fatalf("Expected a %d byte ticket, got %d bytes", 32+4+4+16, len(encrypted))
+	}
+
+	decrypted := &Ticket{}
+
+	if err := decrypted.Decrypt(NewStreamIn(encrypted, nil), []byte("user key")); err != nil {
+		t.Fatalf("Failed to decrypt the ticket: %v", err)
+	}
+
+	if decrypted.ServerPID().Value() != 0 {
+		t.Errorf("Expected an unset server PID to be written as 0, got %s", decrypted.ServerPID())
+	}
+
+	// 8 byte datetime, 4 byte PID and no session key, followed by the checksum
+	encrypted = (&TicketInfo{}).Encrypt([]byte("server key"), NewStreamOut(nil))
+
+	if len(encrypted) != 8+4+16 {
+		t.Errorf("Expected a %d byte ticket info, got %d bytes", 8+4+16, len(encrypted))
+	}
+}
@@ -1,6 +1,9 @@
 package nex
 
 import (
+	"math"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -12,6 +15,14 @@ type StructureInterface interface {
 	Bytes(*StreamOut) []byte
 }
 
+// VersionedStructure is implemented by structures which only support some structure header versions.
+// ReadStructure returns an error when the header version is not one of SupportedVersions, and WriteStructure writes StructureVersion
+type VersionedStructure interface {
+	StructureInterface
+	SupportedVersions() []uint8
+	StructureVersion() uint8
+}
+
 // Structure represents a nex Structure type
 type Structure struct {
 	StructureInterface
@@ -22,6 +33,36 @@ func (structure *Structure) Hierarchy() []StructureInterface {
 	return make([]StructureInterface, 0)
 }
 
+// UsesStructureHeader reports whether structures are encoded with a structure header (version and content length) for the given server.
+// Headers are used from NEX version 3 onwards. A nil server never uses them
+func UsesStructureHeader(server *Server) bool {
+	return server != nil && server.NexVersion() >= 3
+}
+
+// MarshalStructure encodes the given structure without an existing stream.
+// The server is only used to determine the structure encoding and may be nil, in which case no structure header is written
+func MarshalStructure(structure StructureInterface, server *Server) []byte {
+	stream := NewStreamOut(server)
+	stream.WriteStructure(structure)
+
+	return stream.Bytes()
+}
+
+// UnmarshalStructure decodes the given structure from data without an existing stream.
+// The server is only used to determine the structure encoding and may be nil, in which case no structure header is read
+func UnmarshalStructure(data []byte, structure StructureInterface, server *Server) error {
+	stream := NewStreamIn(data, server)
+	_, err := stream.ReadStructure(structure)
+
+	return err
+}
+
+// EncodedLength returns the number of bytes the given structure is encoded as, including structure headers and its Hierarchy.
+// This is useful for pre-sizing buffers or writing length prefixes. The structure is encoded to measure it
+func EncodedLength(structure StructureInterface, server *Server) int {
+	return len(MarshalStructure(structure, server))
+}
+
 // NullData represents a structure with no data
 type NullData struct {
 	*Structure
@@ -117,326 +158,409 @@ func (datetime *DateTime) Now() uint64 {
 	return datetime.value
 }
 
+// FromTimestamp converts the given time into a format DateTime can understand and stores it.
+// The time is converted to UTC and truncated to seconds, matching Standard. Years before 0 cannot be stored
+func (datetime *DateTime) FromTimestamp(timestamp time.Time) uint64 {
+	timestamp = timestamp.UTC()
+
+	second := timestamp.Second()
+	minute := timestamp.Minute()
+	hour := timestamp.Hour()
+	day := timestamp.Day()
+	month := int(timestamp.Month())
+	year := timestamp.Year()
+
+	datetime.value = uint64(second | (minute << 6) | (hour << 12) | (day << 17) | (month << 22) | (year << 26))
+
+	return datetime.value
+}
+
 // Value returns the stored DateTime time
 func (datetime *DateTime) Value() uint64 {
 	return datetime.value
 }
 
+// Second returns the seconds value stored in the DateTime
+func (datetime *DateTime) Second() int {
+	return int(datetime.value & 63)
+}
+
+// Minute returns the minutes value stored in the DateTime
+func (datetime *DateTime) Minute() int {
+	return int((datetime.value >> 6) & 63)
+}
+
+// Hour returns the hours value stored in the DateTime
+func (datetime *DateTime) Hour() int {
+	return int((datetime.value >> 12) & 31)
+}
+
+// Day returns the day value stored in the DateTime
+func (datetime *DateTime) Day() int {
+	return int((datetime.value >> 17) & 31)
+}
+
+// Month returns the month value stored in the DateTime
+func (datetime *DateTime) Month() time.Month {
+	return time.Month((datetime.value >> 22) & 15)
+}
+
+// Year returns the year value stored in the DateTime
+func (datetime *DateTime) Year() int {
+	return int(datetime.value >> 26)
+}
+
+// Standard returns the DateTime as a standard time.Time in UTC.
+// Field values outside their normal ranges, such as a month of 0 or 13, are normalized like time.Date does
+func (datetime *DateTime) Standard() time.Time {
+	return time.Date(datetime.Year(), datetime.Month(), datetime.Day(), datetime.Hour(), datetime.Minute(), datetime.Second(), 0, time.UTC)
+}
+
+// Copy returns a new copied instance of DateTime
+func (datetime *DateTime) Copy() *DateTime {
+	return NewDateTime(datetime.value)
+}
+
+// Equals checks if the passed DateTime contains the same data as the current instance
+func (datetime *DateTime) Equals(other *DateTime) bool {
+	return other != nil && datetime.value == other.value
+}
+
 // NewDateTime returns a new DateTime instance
 func NewDateTime(value uint64) *DateTime {
 	return &DateTime{value: value}
 }
 
-// StationURL contains the data for a NEX station URL
+// NewDateTimeFromTime returns a new DateTime instance holding the given time, see FromTimestamp
+func NewDateTimeFromTime(timestamp time.Time) *DateTime {
+	datetime := NewDateTime(0)
+	datetime.FromTimestamp(timestamp)
+
+	return datetime
+}
+
+// Uses64BitPIDs reports whether PIDs are encoded as 64-bit values for the given server.
+// PIDs are 64-bit from NEX version 4 onwards. A nil server always uses 32-bit PIDs
+func Uses64BitPIDs(server *Server) bool {
+	return server != nil && server.NexVersion() >= 4
+}
+
+// PID represents a NEX PID (principal ID), which is 32-bit before NEX version 4 and 64-bit after
+type PID struct {
+	pid     uint64
+	is64Bit bool
+}
+
+// Value returns the PID value
+func (pid *PID) Value() uint64 {
+	return pid.pid
+}
+
+// LegacyValue returns the PID as a 32-bit value. PIDs which do not fit in 32 bits return 0 rather than a truncated, unrelated PID
+func (pid *PID) LegacyValue() uint32 {
+	if pid.pid > math.MaxUint32 {
+		return 0
+	}
+
+	return uint32(pid.pid)
+}
+
+// Is64Bit reports whether the PID was created or read as a 64-bit PID
+func (pid *PID) Is64Bit() bool {
+	return pid.is64Bit
+}
+
+// Copy returns a new copy of the PID
+func (pid *PID) Copy() *PID {
+	return &PID{pid: pid.pid, is64Bit: pid.is64Bit}
+}
+
+// Equals checks if the PID has the same value as the given PID, regardless of width
+func (pid *PID) Equals(other *PID) bool {
+	return other != nil && pid.pid == other.pid
+}
+
+// String returns the PID value as a string
+func (pid *PID) String() string {
+	return strconv.FormatUint(pid.pid, 10)
+}
+
+// NewPID returns a new 64-bit PID
+func NewPID(pid uint64) *PID {
+	return &PID{pid: pid, is64Bit: true}
+}
+
+// NewLegacyPID returns a new 32-bit PID
+func NewLegacyPID(pid uint32) *PID {
+	return &PID{pid: uint64(pid)}
+}
+
+// StationURL contains the data for a NEX station URL, in the format scheme:/key=value;key=value.
+// Fields are kept in the order they were parsed or first set, as some clients are sensitive to the field order
 type StationURL struct {
-	// Using pointers to check for nil
-	scheme        *string
-	address       *string
-	port          *string
-	stream        *string
-	sid           *string
-	cid           *string
-	pid           *string
-	transportType *string
-	rvcid         *string
-	natm          *string
-	natf          *string
-	upnp          *string
-	pmp           *string
-	probeinit     *string
-	prid          *string
+	scheme string
+	fields []stationURLField
+}
+
+type stationURLField struct {
+	key   string
+	value string
 }
 
 // SetScheme sets the StationURL scheme
 func (station *StationURL) SetScheme(scheme *string) {
-	station.scheme = scheme
+	if scheme != nil {
+		station.scheme = *scheme
+	} else {
+		station.scheme = ""
+	}
+}
+
+// Scheme returns the StationURL scheme
+func (station *StationURL) Scheme() string {
+	return station.scheme
+}
+
+// Get returns the value of the field with the given key, and whether the field is set
+func (station *StationURL) Get(key string) (string, bool) {
+	for _, field := range station.fields {
+		if field.key == key {
+			return field.value, true
+		}
+	}
+
+	return "", false
+}
+
+// Set sets the value of the field with the given key. New fields are added after the existing ones
+func (station *StationURL) Set(key string, value string) {
+	for i := range station.fields {
+		if station.fields[i].key == key {
+			station.fields[i].value = value
+			return
+		}
+	}
+
+	station.fields = append(station.fields, stationURLField{key: key, value: value})
+}
+
+// Delete removes the field with the given key
+func (station *StationURL) Delete(key string) {
+	for i, field := range station.fields {
+		if field.key == key {
+			station.fields = append(station.fields[:i], station.fields[i+1:]...)
+			return
+		}
+	}
+}
+
+// Fields returns a copy of all the StationURL fields
+func (station *StationURL) Fields() map[string]string {
+	fields := make(map[string]string, len(station.fields))
+
+	for _, field := range station.fields {
+		fields[field.key] = field.value
+	}
+
+	return fields
+}
+
+// setField sets the field if value is not nil and removes it otherwise
+func (station *StationURL) setField(key string, value *string) {
+	if value != nil {
+		station.Set(key, *value)
+	} else {
+		station.Delete(key)
+	}
+}
+
+// getField returns the value of the field, or an empty string if it is not set
+func (station *StationURL) getField(key string) string {
+	value, _ := station.Get(key)
+
+	return value
 }
 
 // SetAddress sets the StationURL address
 func (station *StationURL) SetAddress(address *string) {
-	station.address = address
+	station.setField("address", address)
 }
 
 // SetPort sets the StationURL port
 func (station *StationURL) SetPort(port *string) {
-	station.port = port
+	station.setField("port", port)
 }
 
 // SetStream sets the StationURL stream
 func (station *StationURL) SetStream(stream *string) {
-	station.stream = stream
+	station.setField("stream", stream)
 }
 
 // SetSID sets the StationURL SID
 func (station *StationURL) SetSID(sid *string) {
-	station.sid = sid
+	station.setField("sid", sid)
 }
 
 // SetCID sets the StationURL CID
 func (station *StationURL) SetCID(cid *string) {
-	station.cid = cid
+	station.setField("CID", cid)
 }
 
 // SetPid sets the StationURL PID
 func (station *StationURL) SetPid(pid *string) {
-	station.pid = pid
+	station.setField("PID", pid)
 }
 
 // SetType sets the StationURL transportType
 func (station *StationURL) SetType(transportType *string) {
-	station.transportType = transportType
+	station.setField("type", transportType)
 }
 
 // SetRVCID sets the StationURL RVCID
 func (station *StationURL) SetRVCID(rvcid *string) {
-	station.rvcid = rvcid
+	station.setField("RVCID", rvcid)
 }
 
 // SetNatm sets the StationURL Natm
 func (station *StationURL) SetNatm(natm *string) {
-	station.natm = natm
+	station.setField("natm", natm)
 }
 
 // SetNatf sets the StationURL Natf
 func (station *StationURL) SetNatf(natf *string) {
-	station.natf = natf
+	station.setField("natf", natf)
 }
 
 // SetUpnp sets the StationURL Upnp
 func (station *StationURL) SetUpnp(upnp *string) {
-	station.upnp = upnp
+	station.setField("upnp", upnp)
 }
 
 // SetPmp sets the StationURL Pmp
 func (station *StationURL) SetPmp(pmp *string) {
-	station.pmp = pmp
+	station.setField("pmp", pmp)
 }
 
 // SetProbeInit sets the StationURL ProbeInit
 func (station *StationURL) SetProbeInit(probeinit *string) {
-	station.probeinit = probeinit
+	station.setField("probeinit", probeinit)
 }
 
 // SetPRID sets the StationURL PRID
 func (station *StationURL) SetPRID(prid *string) {
-	station.prid = prid
-}
-
-func (station *StationURL) Scheme() string {
-	if station.scheme != nil {
-		return *station.address
-	}
-	return ""
+	station.setField("PRID", prid)
 }
 
+// Address returns the StationURL address
 func (station *StationURL) Address() string {
-	if station.address != nil {
-		return *station.address
-	}
-	return ""
+	return station.getField("address")
 }
 
+// Port returns the StationURL port
 func (station *StationURL) Port() string {
-	if station.port != nil {
-		return *station.port
-	}
-	return ""
+	return station.getField("port")
 }
 
+// Stream returns the StationURL stream
 func (station *StationURL) Stream() string {
-	if station.stream != nil {
-		return *station.stream
-	}
-	return ""
+	return station.getField("stream")
 }
 
+// SID returns the StationURL SID
 func (station *StationURL) SID() string {
-	if station.sid != nil {
-		return *station.sid
-	}
-	return ""
+	return station.getField("sid")
 }
 
+// CID returns the StationURL CID
 func (station *StationURL) CID() string {
-	if station.cid != nil {
-		return *station.cid
-	}
-	return ""
+	return station.getField("CID")
 }
 
+// PID returns the StationURL PID
 func (station *StationURL) PID() string {
-	if station.pid != nil {
-		return *station.pid
-	}
-	return ""
+	return station.getField("PID")
 }
 
+// Type returns the StationURL transportType
 func (station *StationURL) Type() string {
-	if station.transportType != nil {
-		return *station.transportType
-	}
-	return ""
+	return station.getField("type")
 }
 
+// RVCID returns the StationURL RVCID
 func (station *StationURL) RVCID() string {
-	if station.rvcid != nil {
-		return *station.rvcid
-	}
-	return ""
+	return station.getField("RVCID")
 }
 
+// Natm returns the StationURL Natm
 func (station *StationURL) Natm() string {
-	if station.natm != nil {
-		return *station.natm
-	}
-	return ""
+	return station.getField("natm")
 }
 
+// Natf returns the StationURL Natf
 func (station *StationURL) Natf() string {
-	if station.natf != nil {
-		return *station.natf
-	}
-	return ""
+	return station.getField("natf")
 }
 
+// Upnp returns the StationURL Upnp
 func (station *StationURL) Upnp() string {
-	if station.upnp != nil {
-		return *station.upnp
-	}
-	return ""
+	return station.getField("upnp")
 }
 
+// Pmp returns the StationURL Pmp
 func (station *StationURL) Pmp() string {
-	if station.pmp != nil {
-		return *station.pmp
-	}
-	return ""
+	return station.getField("pmp")
 }
 
+// ProbeInit returns the StationURL ProbeInit
 func (station *StationURL) ProbeInit() string {
-	if station.probeinit != nil {
-		return *station.probeinit
-	}
-	return ""
+	return station.getField("probeinit")
 }
 
+// PRID returns the StationURL PRID
 func (station *StationURL) PRID() string {
-	if station.prid != nil {
-		return *station.prid
-	}
-	return ""
+	return station.getField("PRID")
 }
 
-// FromString parses the StationURL data from a string
+// FromString parses the StationURL data from a string, replacing any existing data.
+// A string with no ":/" separator is treated as a scheme with no fields, and fields with no "=" are given an empty value
 func (station *StationURL) FromString(str string) {
-	split := strings.Split(str, ":/")
-
-	station.scheme = &split[0]
-	fields := split[1]
-
-	params := strings.Split(fields, ";")
-
-	for i := 0; i < len(params); i++ {
-		param := params[i]
-		split = strings.Split(param, "=")
-
-		name := split[0]
-		value := split[1]
-
-		switch name {
-		case "address":
-			station.address = &value
-		case "port":
-			station.port = &value
-		case "stream":
-			station.stream = &value
-		case "sid":
-			station.sid = &value
-		case "CID":
-			station.cid = &value
-		case "PID":
-			station.pid = &value
-		case "type":
-			station.transportType = &value
-		case "RVCID":
-			station.rvcid = &value
-		case "natm":
-			station.natm = &value
-		case "natf":
-			station.natf = &value
-		case "upnp":
-			station.upnp = &value
-		case "pmp":
-			station.pmp = &value
-		case "probeinit":
-			station.probeinit = &value
-		case "PRID":
-			station.prid = &value
-		}
-	}
-}
-
-// EncodeToString encodes the StationURL into a string
-func (station *StationURL) EncodeToString() string {
-	fields := []string{}
-
-	if station.address != nil {
-		fields = append(fields, "address="+*station.address)
-	}
-
-	if station.port != nil {
-		fields = append(fields, "port="+*station.port)
-	}
-
-	if station.stream != nil {
-		fields = append(fields, "stream="+*station.stream)
-	}
-
-	if station.sid != nil {
-		fields = append(fields, "sid="+*station.sid)
-	}
-
-	if station.cid != nil {
-		fields = append(fields, "CID="+*station.cid)
-	}
+	station.fields = nil
 
-	if station.pid != nil {
-		fields = append(fields, "PID="+*station.pid)
-	}
+	separator := strings.Index(str, ":/")
 
-	if station.transportType != nil {
-		fields = append(fields, "type="+*station.transportType)
+	if separator == -1 {
+		station.scheme = str
+		return
 	}
 
-	if station.rvcid != nil {
-		fields = append(fields, "RVCID="+*station.rvcid)
-	}
+	station.scheme = str[:separator]
 
-	if station.natm != nil {
-		fields = append(fields, "natm="+*station.natm)
-	}
+	params := strings.Split(str[separator+2:], ";")
 
-	if station.natf != nil {
-		fields = append(fields, "natf="+*station.natf)
-	}
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
 
-	if station.upnp != nil {
-		fields = append(fields, "upnp="+*station.upnp)
-	}
+		split := strings.SplitN(param, "=", 2)
 
-	if station.pmp != nil {
-		fields = append(fields, "pmp="+*station.pmp)
+		if len(split) == 1 {
+			station.Set(split[0], "")
+		} else {
+			station.Set(split[0], split[1])
+		}
 	}
+}
 
-	if station.probeinit != nil {
-		fields = append(fields, "probeinit="+*station.probeinit)
-	}
+// EncodeToString encodes the StationURL into a string
+func (station *StationURL) EncodeToString() string {
+	fields := make([]string, 0, len(station.fields))
 
-	if station.prid != nil {
-		fields = append(fields, "PRID="+*station.prid)
+	for _, field := range station.fields {
+		fields = append(fields, field.key+"="+field.value)
 	}
 
-	return *station.scheme + ":/" + strings.Join(fields, ";")
+	return station.scheme + ":/" + strings.Join(fields, ";")
 }
 
 // NewStationURL returns a new StationURL instance
@@ -449,3 +573,17 @@ func NewStationURL(str string) *StationURL {
 
 	return station
 }
+
+// NewStationURLFromUDPAddr returns a new StationURL instance with the address and port of the given UDP address
+func NewStationURLFromUDPAddr(scheme string, addr *net.UDPAddr) *StationURL {
+	address := addr.IP.String()
+	port := strconv.Itoa(addr.Port)
+
+	station := &StationURL{}
+
+	station.SetScheme(&scheme)
+	station.SetAddress(&address)
+	station.SetPort(&port)
+
+	return station
+}
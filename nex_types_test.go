@@ -0,0 +1,309 @@
+package nex
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testParentStructure is the parent of testStructure
+type testParentStructure struct {
+	Structure
+	flags uint8
+}
+
+func (structure *testParentStructure) ExtractFromStream(stream *StreamIn) error {
+	err := stream.checkRemaining("testParentStructure", 1)
+
+	if err != nil {
+		return err
+	}
+
+	structure.flags = stream.ReadUInt8()
+
+	return nil
+}
+
+func (structure *testParentStructure) Bytes(stream *StreamOut) []byte {
+	stream.WriteUInt8(structure.flags)
+
+	return stream.Bytes()
+}
+
+// testStructure is a structure with a parent, used to test structure encoding
+type testStructure struct {
+	Structure
+	parent *testParentStructure
+	id     uint32
+	name   string
+}
+
+func (structure *testStructure) Hierarchy() []StructureInterface {
+	return []StructureInterface{structure.parent}
+}
+
+func (structure *testStructure) ExtractFromStream(stream *StreamIn) error {
+	err := stream.checkRemaining("testStructure", 4)
+
+	if err != nil {
+		return err
+	}
+
+	structure.id = stream.ReadUInt32LE()
+	structure.name, err = stream.ReadString()
+
+	return err
+}
+
+func (structure *testStructure) Bytes(stream *StreamOut) []byte {
+	stream.WriteUInt32LE(structure.id)
+	stream.WriteString(structure.name)
+
+	return stream.Bytes()
+}
+
+func newTestStructure(flags uint8, id uint32, name string) *testStructure {
+	return &testStructure{
+		parent: &testParentStructure{flags: flags},
+		id:     id,
+		name:   name,
+	}
+}
+
+// testBufferStructure is a structure holding a Buffer and a qBuffer
+type testBufferStructure struct {
+	Structure
+	buffer  []byte
+	qBuffer []byte
+}
+
+func (structure *testBufferStructure) ExtractFromStream(stream *StreamIn) error {
+	var err error
+
+	structure.buffer, err = stream.ReadBuffer()
+
+	if err != nil {
+		return err
+	}
+
+	structure.qBuffer, err = stream.ReadQBuffer()
+
+	return err
+}
+
+func (structure *testBufferStructure) Bytes(stream *StreamOut) []byte {
+	stream.WriteBuffer(structure.buffer)
+	stream.WriteQBuffer(structure.qBuffer)
+
+	return stream.Bytes()
+}
+
+// newTestStructureServer returns a server using the given NEX version, which decides whether structure headers are used
+func newTestStructureServer(nexVersion int) *Server {
+	server := NewServer()
+	server.SetNexVersion(nexVersion)
+
+	return server
+}
+
+func TestNewStationURLFromUDPAddr(t *testing.T) {
+	addr := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 20), Port: 60001}
+
+	station := NewStationURLFromUDPAddr("prudps", addr)
+
+	if station.Scheme() != "prudps" {
+		t.Errorf("Expected scheme prudps, got %q", station.Scheme())
+	}
+
+	if station.Address() != "192.168.1.20" {
+		t.Errorf("Expected address 192.168.1.20, got %q", station.Address())
+	}
+
+	if station.Port() != "60001" {
+		t.Errorf("Expected port 60001, got %q", station.Port())
+	}
+
+	if station.EncodeToString() != "prudps:/address=192.168.1.20;port=60001" {
+		t.Errorf("Unexpected StationURL %q", station.EncodeToString())
+	}
+}
+
+func TestMarshalStructureRoundTrip(t *testing.T) {
+	for _, server := range []*Server{nil, newTestStructureServer(2), newTestStructureServer(3)} {
+		original := newTestStructure(0x05, 1234, "Pretendo")
+
+		data := MarshalStructure(original, server)
+
+		decoded := newTestStructure(0, 0, "")
+		err := UnmarshalStructure(data, decoded, server)
+
+		if err != nil {
+			t.Fatalf("UnmarshalStructure failed: %v", err)
+		}
+
+		if decoded.parent.flags != 0x05 || decoded.id != 1234 || decoded.name != "Pretendo" {
+			t.Errorf("Structure did not round-trip, got flags %d id %d name %q", decoded.parent.flags, decoded.id, decoded.name)
+		}
+
+		if !bytes.Equal(MarshalStructure(decoded, server), data) {
+			t.Error("Re-encoding the decoded structure gave different data")
+		}
+	}
+
+	// The parent and the structure each get a 5 byte header from NEX 3 onwards
+	withoutHeaders := MarshalStructure(newTestStructure(0, 0, ""), newTestStructureServer(2))
+	withHeaders := MarshalStructure(newTestStructure(0, 0, ""), newTestStructureServer(3))
+
+	if len(withHeaders)-len(withoutHeaders) != 10 {
+		t.Errorf("Expected structure headers to add 10 bytes, got %d", len(withHeaders)-len(withoutHeaders))
+	}
+}
+
+func TestUnmarshalStructureTruncated(t *testing.T) {
+	data := MarshalStructure(newTestStructure(0x05, 1234, "Pretendo"), nil)
+
+	err := UnmarshalStructure(data[:3], newTestStructure(0, 0, ""), nil)
+
+	if err == nil {
+		t.Error("Expected an error for truncated structure data")
+	}
+}
+
+func TestEncodedLength(t *testing.T) {
+	structure := newTestStructure(0x05, 1234, "Pretendo")
+
+	// 1 byte of flags in the parent, then a 4 byte ID and a string with a 2 byte length and a null terminator
+	if length := EncodedLength(structure, newTestStructureServer(2)); length != 16 {
+		t.Errorf("Expected 16 bytes without structure headers, got %d", length)
+	}
+
+	if length := EncodedLength(structure, newTestStructureServer(3)); length != 26 {
+		t.Errorf("Expected 26 bytes with structure headers, got %d", length)
+	}
+
+	// A 4 byte length before the Buffer and a 2 byte length before the qBuffer
+	buffers := &testBufferStructure{buffer: make([]byte, 10), qBuffer: make([]byte, 3)}
+
+	if length := EncodedLength(buffers, nil); length != 19 {
+		t.Errorf("Expected 19 bytes for the Buffer and qBuffer, got %d", length)
+	}
+
+	if length := EncodedLength(NewNullData(), newTestStructureServer(3)); length != 5 {
+		t.Errorf("Expected NullData to only be a structure header, got %d bytes", length)
+	}
+
+	for _, server := range []*Server{nil, newTestStructureServer(3)} {
+		if length := EncodedLength(structure, server); length != len(MarshalStructure(structure, server)) {
+			t.Errorf("Encoded length %d does not match the marshalled structure", length)
+		}
+	}
+}
+
+func TestDateTimeRoundTrip(t *testing.T) {
+	timestamp := time.Date(2023, time.November, 14, 22, 13, 20, 500, time.FixedZone("UTC+2", 2*60*60))
+
+	datetime := NewDateTimeFromTime(timestamp)
+
+	if datetime.Year() != 2023 || datetime.Month() != time.November || datetime.Day() != 14 ||
+		datetime.Hour() != 20 || datetime.Minute() != 13 || datetime.Second() != 20 {
+		t.Errorf("Unexpected fields %d-%d-%d %d:%d:%d", datetime.Year(), datetime.Month(), datetime.Day(),
+			datetime.Hour(), datetime.Minute(), datetime.Second())
+	}
+
+	// Converted to UTC and truncated to seconds
+	expected := time.Date(2023, time.November, 14, 20, 13, 20, 0, time.UTC)
+
+	if !datetime.Standard().Equal(expected) {
+		t.Errorf("Expected %s, got %s", expected, datetime.Standard())
+	}
+
+	stream := NewStreamOut(nil)
+	stream.WriteDateTime(datetime)
+
+	decoded := NewStreamIn(stream.Bytes(), nil).ReadDateTime()
+
+	if !decoded.Equals(datetime) {
+		t.Errorf("Expected %X to round-trip, got %X", datetime.Value(), decoded.Value())
+	}
+}
+
+func TestUsesStructureHeader(t *testing.T) {
+	if UsesStructureHeader(nil) {
+		t.Error("Expected no structure header without a server")
+	}
+
+	for nexVersion, expected := range map[int]bool{0: false, 2: false, 3: true, 4: true} {
+		if UsesStructureHeader(newTestStructureServer(nexVersion)) != expected {
+			t.Errorf("NEX version %d: expected UsesStructureHeader to be %t", nexVersion, expected)
+		}
+	}
+}
+
+func TestReadStructureWithSize(t *testing.T) {
+	for _, server := range []*Server{newTestStructureServer(2), newTestStructureServer(3)} {
+		first := MarshalStructure(newTestStructure(0x01, 1, "a"), server)
+		second := MarshalStructure(newTestStructure(0x02, 2, "Pretendo"), server)
+
+		stream := NewStreamIn(append(append([]byte{}, first...), second...), server)
+
+		_, firstSize, err := stream.ReadStructureWithSize(newTestStructure(0, 0, ""))
+
+		if err != nil || firstSize != len(first) {
+			t.Errorf("NEX version %d: expected the first structure to take %d bytes, got %d (error %v)", server.NexVersion(), len(first), firstSize, err)
+		}
+
+		structure, secondSize, err := stream.ReadStructureWithSize(newTestStructure(0, 0, ""))
+
+		if err != nil || secondSize != len(second) {
+			t.Errorf("NEX version %d: expected the second structure to take %d bytes, got %d (error %v)", server.NexVersion(), len(second), secondSize, err)
+		}
+
+		if decoded := structure.(*testStructure); decoded.id != 2 || decoded.name != "Pretendo" {
+			t.Errorf("NEX version %d: second structure decoded as id %d name %q", server.NexVersion(), decoded.id, decoded.name)
+		}
+
+		if firstSize+secondSize != len(stream.Bytes()) {
+			t.Errorf("NEX version %d: sizes add up to %d, expected %d", server.NexVersion(), firstSize+secondSize, len(stream.Bytes()))
+		}
+	}
+}
+
+// testVersionedStructure is a testStructure which is written as and only supports structure version 2
+type testVersionedStructure struct {
+	testStructure
+}
+
+func (structure *testVersionedStructure) SupportedVersions() []uint8 {
+	return []uint8{2}
+}
+
+func (structure *testVersionedStructure) StructureVersion() uint8 {
+	return 2
+}
+
+func TestReadStructureUnsupportedVersion(t *testing.T) {
+	server := newTestStructureServer(3)
+
+	data := MarshalStructure(&testVersionedStructure{testStructure: *newTestStructure(0x05, 1234, "Pretendo")}, server)
+
+	// The structure header follows the 5 byte header and 1 byte content of the parent, which has no declared version
+	if data[0] != 1 || data[6] != 2 {
+		t.Fatalf("Expected the parent to be written as version 1 and the structure as version 2, got % X", data)
+	}
+
+	structure := &testVersionedStructure{testStructure: *newTestStructure(0, 0, "")}
+
+	if err := UnmarshalStructure(data, structure, server); err != nil || structure.id != 1234 {
+		t.Errorf("Expected the declared version to be read back, got id %d (error %v)", structure.id, err)
+	}
+
+	data[6] = 1
+
+	err := UnmarshalStructure(data, structure, server)
+
+	if err == nil || !strings.Contains(err.Error(), "Unsupported structure version 1") {
+		t.Errorf("Expected an unsupported structure version error, got %v", err)
+	}
+}
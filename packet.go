@@ -15,11 +15,14 @@ type Packet struct {
 	connectionSignature []byte
 	fragmentID          uint8
 	payload             []byte
+	deciphered          []byte
 	rmcRequest          RMCRequest
+	hasRMCRequest       bool
 	PacketInterface
 }
 
-// Data returns bytes used to create the packet (this is not the same as Bytes())
+// Data returns bytes used to create the packet (this is not the same as Bytes()).
+// For received packets this is the datagram the packet was decoded from. The slice is not copied, so copy it before modifying it
 func (packet *Packet) Data() []byte {
 	return packet.data
 }
@@ -159,6 +162,38 @@ func (packet *Packet) RMCRequest() RMCRequest {
 	return packet.rmcRequest
 }
 
+// basePacket returns the generic Packet of a PRUDP v0 or v1 packet, or nil for other PacketInterface implementations
+func basePacket(packet PacketInterface) *Packet {
+	switch packet := packet.(type) {
+	case *PacketV0:
+		return &packet.Packet
+	case *PacketV1:
+		return &packet.Packet
+	}
+
+	return nil
+}
+
+// decipherPayload deciphers the payload of a received DATA packet with the sender decipher stream
+func (packet *Packet) decipherPayload() {
+	packet.deciphered = make([]byte, len(packet.payload))
+	packet.sender.Decipher().XORKeyStream(packet.deciphered, packet.payload)
+}
+
+// copy returns a copy of the packet which shares the sender but none of the byte slices
+func (packet *Packet) copy() Packet {
+	copied := *packet
+
+	copied.data = append([]byte{}, packet.data...)
+	copied.signature = append([]byte{}, packet.signature...)
+	copied.connectionSignature = append([]byte{}, packet.connectionSignature...)
+	copied.payload = append([]byte{}, packet.payload...)
+	copied.deciphered = append([]byte{}, packet.deciphered...)
+	copied.rmcRequest.parameters = append([]byte{}, packet.rmcRequest.parameters...)
+
+	return copied
+}
+
 // NewPacket returns a new PRUDP packet generic
 func NewPacket(client *Client, data []byte) Packet {
 	packet := Packet{
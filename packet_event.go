@@ -0,0 +1,24 @@
+package nex
+
+// PacketEvent holds the packet data passed to event handlers of type func(*PacketEvent)
+type PacketEvent struct {
+	Client     *Client
+	Packet     PacketInterface
+	RMCRequest *RMCRequest // Only set for DATA packets carrying an RMC request
+}
+
+// NewPacketEvent returns a new PacketEvent for the given packet
+func NewPacketEvent(packet PacketInterface) *PacketEvent {
+	event := &PacketEvent{
+		Client: packet.Sender(),
+		Packet: packet,
+	}
+
+	// Fragments before the last, duplicates and payloads which failed to parse carry no request
+	if base := basePacket(packet); base != nil && base.hasRMCRequest {
+		request := packet.RMCRequest()
+		event.RMCRequest = &request
+	}
+
+	return event
+}
@@ -0,0 +1,96 @@
+package nex
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPacketEventHandlerReceivesRMCRequest(t *testing.T) {
+	events := make(chan *PacketEvent, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.On("Data", func(event *PacketEvent) {
+			events <- event
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	parameters := []byte{0x01, 0x02, 0x03, 0x04}
+	client.sendData(newTestRMCRequest(0x0A, 5, 3, parameters))
+
+	var event *PacketEvent
+
+	select {
+	case event = <-events:
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the DATA event")
+	}
+
+	if event.Client != client.client {
+		t.Error("Event client is not the client which sent the packet")
+	}
+
+	if event.Packet == nil || event.Packet.Type() != DataPacket {
+		t.Fatal("Event does not carry the DATA packet")
+	}
+
+	if event.RMCRequest == nil {
+		t.Fatal("Event does not carry the RMC request")
+	}
+
+	request := event.RMCRequest
+
+	if request.ProtocolID() != 0x0A || request.CallID() != 5 || request.MethodID() != 3 || !bytes.Equal(request.Parameters(), parameters) {
+		t.Errorf("Unexpected RMC request: protocol %X call %d method %d parameters % X",
+			request.ProtocolID(), request.CallID(), request.MethodID(), request.Parameters())
+	}
+}
+
+func TestPacketEventWithoutRMCRequest(t *testing.T) {
+	events := make(chan *PacketEvent, 4)
+
+	server := newTestServer(t, func(server *Server) {
+		server.On("Packet", func(event *PacketEvent) {
+			if event.Packet.Type() == DataPacket {
+				events <- event
+			}
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	payload := newTestRMCRequest(0x0A, 1, 2, []byte{0x01, 0x02, 0x03, 0x04})
+
+	client.sendPacket(client.newDataPacket(payload[:8], 1))
+	client.sendPacket(client.newDataPacket(payload[8:], 0))
+
+	// A payload too short to hold an RMC request
+	client.sendData([]byte{0x01})
+
+	received := make(map[uint16]*PacketEvent)
+
+	for len(received) < 3 {
+		select {
+		case event := <-events:
+			received[event.Packet.SequenceID()] = event
+		case <-time.After(testTimeout):
+			t.Fatalf("Timed out waiting for the DATA packet events, got %d", len(received))
+		}
+	}
+
+	if received[2].RMCRequest != nil {
+		t.Error("Expected no RMC request for the first fragment")
+	}
+
+	if received[3].RMCRequest == nil || received[3].RMCRequest.MethodID() != 2 {
+		t.Error("Expected the RMC request for the final fragment")
+	}
+
+	if received[4].RMCRequest != nil {
+		t.Error("Expected no RMC request for a payload which failed to parse")
+	}
+}
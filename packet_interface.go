@@ -2,6 +2,7 @@ package nex
 
 // PacketInterface implements all Packet methods
 type PacketInterface interface {
+	Data() []byte
 	Sender() *Client
 	SetVersion(version uint8)
 	Version() uint8
@@ -30,4 +31,5 @@ type PacketInterface interface {
 	Payload() []byte
 	RMCRequest() RMCRequest
 	Bytes() []byte
+	Copy() PacketInterface
 }
@@ -1,8 +1,6 @@
 package nex
 
 import (
-	"crypto/hmac"
-	"crypto/md5"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -97,20 +95,8 @@ func (packet *PacketV0) Decode() error {
 
 		payloadCrypted := stream.ReadBytesNext(int64(payloadSize))
 
+		// DATA payloads are deciphered by the server in sequence ID order, as the RC4 stream depends on it
 		packet.SetPayload(payloadCrypted)
-
-		if packet.Type() == DataPacket {
-			ciphered := make([]byte, payloadSize)
-			packet.Sender().Decipher().XORKeyStream(ciphered, payloadCrypted)
-
-			request, err := NewRMCRequest(ciphered)
-
-			if err != nil {
-				return errors.New("[PRUDPv0] Error parsing RMC request: " + err.Error())
-			}
-
-			packet.rmcRequest = request
-		}
 	}
 
 	if len(packet.Data()[stream.ByteOffset():]) < int(checksumSize) {
@@ -123,6 +109,10 @@ func (packet *PacketV0) Decode() error {
 		packet.SetChecksum(stream.ReadUInt32LE())
 	}
 
+	if packet.Sender().Server().StrictDatagramParsing() && len(packet.Data()[stream.ByteOffset():]) > 0 {
+		return errors.New("[PRUDPv0] Trailing data after packet")
+	}
+
 	packetBody := stream.Bytes()
 
 	calculatedChecksum := packet.calculateChecksum(packetBody[:len(packetBody)-checksumSize])
@@ -215,11 +205,7 @@ func (packet *PacketV0) calculateSignature() []byte {
 				return signature.Bytes()
 			}
 
-			key := packet.Sender().SignatureKey()
-			cipher := hmac.New(md5.New, key)
-			cipher.Write(payload)
-
-			return cipher.Sum(nil)[:4]
+			return packet.Sender().calculateHMAC(payload)[:4]
 		}
 
 		clientConnectionSignature := packet.Sender().ClientConnectionSignature()
@@ -246,11 +232,7 @@ func (packet *PacketV0) calculateSignature() []byte {
 				payload.WriteBytesNext(pktpay)
 			}
 
-			key := packet.Sender().SignatureKey()
-			cipher := hmac.New(md5.New, key)
-			cipher.Write(payload.Bytes())
-
-			return cipher.Sum(nil)[:4]
+			return packet.Sender().calculateHMAC(payload.Bytes())[:4]
 		} else {
 			clientConnectionSignature := packet.Sender().ClientConnectionSignature()
 
@@ -315,6 +297,14 @@ func (packet *PacketV0) calculateChecksum(data []byte) uint32 {
 	return uint32(checksum & 0xFF)
 }
 
+// Copy returns a copy of the packet which can be modified without affecting the original
+func (packet *PacketV0) Copy() PacketInterface {
+	return &PacketV0{
+		Packet:   packet.Packet.copy(),
+		checksum: packet.checksum,
+	}
+}
+
 // NewPacketV0 returns a new PRUDPv0 packet
 func NewPacketV0(client *Client, data []byte) (*PacketV0, error) {
 	packet := NewPacket(client, data)
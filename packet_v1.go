@@ -2,8 +2,6 @@ package nex
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/md5"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -138,21 +136,12 @@ func (packet *PacketV1) Decode() error {
 
 		payloadCrypted := stream.ReadBytesNext(int64(payloadSize))
 
+		// DATA payloads are deciphered by the server in sequence ID order, as the RC4 stream depends on it
 		packet.SetPayload(payloadCrypted)
+	}
 
-		if packet.Type() == DataPacket && !packet.HasFlag(FlagMultiAck) {
-			ciphered := make([]byte, payloadSize)
-
-			packet.Sender().Decipher().XORKeyStream(ciphered, payloadCrypted)
-
-			request, err := NewRMCRequest(ciphered)
-
-			if err != nil {
-				return errors.New("[PRUDPv1] Error parsing RMC request: " + err.Error())
-			}
-
-			packet.rmcRequest = request
-		}
+	if packet.Sender().Server().StrictDatagramParsing() && len(packet.Data()[stream.ByteOffset():]) > 0 {
+		return errors.New("[PRUDPv1] Trailing data after packet")
 	}
 
 	calculatedSignature := packet.calculateSignature(packet.Data()[2:14], packet.Sender().ServerConnectionSignature(), options, packet.Payload())
@@ -288,21 +277,27 @@ func (packet *PacketV1) encodeOptions() []byte {
 }
 
 func (packet *PacketV1) calculateSignature(header []byte, connectionSignature []byte, options []byte, payload []byte) []byte {
-	key := packet.Sender().SignatureKey()
-
 	signatureBase := make([]byte, 4)
 	binary.LittleEndian.PutUint32(signatureBase, uint32(packet.Sender().SignatureBase()))
 
-	mac := hmac.New(md5.New, key)
+	// Packets sent before the client has authenticated (SYN, CONNECT, and everything on non-secure servers)
+	// have no session key, in which case it is left out of the signature entirely.
+	// Writing an empty session key to the HMAC is a no-op
+	sessionKey := packet.Sender().SessionKey()
 
-	mac.Write(header[4:])
-	mac.Write(packet.Sender().SessionKey())
-	mac.Write(signatureBase)
-	mac.Write(connectionSignature)
-	mac.Write(options)
-	mac.Write(payload)
+	return packet.Sender().calculateHMAC(header[4:], sessionKey, signatureBase, connectionSignature, options, payload)
+}
 
-	return mac.Sum(nil)
+// Copy returns a copy of the packet which can be modified without affecting the original
+func (packet *PacketV1) Copy() PacketInterface {
+	return &PacketV1{
+		Packet:             packet.Packet.copy(),
+		magic:              append([]byte{}, packet.magic...),
+		substreamID:        packet.substreamID,
+		supportedFunctions: packet.supportedFunctions,
+		initialSequenceID:  packet.initialSequenceID,
+		maximumSubstreamID: packet.maximumSubstreamID,
+	}
 }
 
 // NewPacketV1 returns a new PRUDPv1 packet
@@ -0,0 +1,134 @@
+package nex
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"testing"
+)
+
+// newTestSigningClient returns a client of a PRUDPv1 server using the given access key, for encoding packets without a socket
+func newTestSigningClient(accessKey string) *Client {
+	server := NewServer()
+	server.SetAccessKey(accessKey)
+
+	return NewClient(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60000}, server)
+}
+
+func TestPacketV1SignatureWithoutSessionKey(t *testing.T) {
+	client := newTestSigningClient("ridfebb9")
+
+	packet, _ := NewPacketV1(client, nil)
+	packet.SetVersion(1)
+	packet.SetSource(0xAF)
+	packet.SetDestination(0xA1)
+	packet.SetType(SynPacket)
+	packet.SetFlags(FlagNeedsAck)
+	packet.SetConnectionSignature(make([]byte, 16))
+
+	data := packet.Bytes()
+
+	expected, _ := hex.DecodeString("073cc77ce4ca40992642f7da546e597a")
+
+	if !bytes.Equal(data[14:30], expected) {
+		t.Errorf("Expected SYN signature %X, got %X", expected, data[14:30])
+	}
+}
+
+func TestPacketV1SignatureWithSessionKey(t *testing.T) {
+	client := newTestSigningClient("ridfebb9")
+	client.SetSessionKey([]byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E, 0x1F,
+	})
+	client.SetClientConnectionSignature([]byte{
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E, 0x1F,
+	})
+
+	packet, _ := NewPacketV1(client, nil)
+	packet.SetVersion(1)
+	packet.SetSource(0xAF)
+	packet.SetDestination(0xA1)
+	packet.SetType(DataPacket)
+	packet.SetFlags(FlagReliable | FlagNeedsAck)
+	packet.SetSessionID(0x2A)
+	packet.SetSequenceID(2)
+	packet.SetPayload([]byte("hello"))
+
+	data := packet.Bytes()
+
+	expected, _ := hex.DecodeString("3c0c7e29bd9f1e7346fa3a6f630566ae")
+
+	if !bytes.Equal(data[14:30], expected) {
+		t.Errorf("Expected DATA signature %X, got %X", expected, data[14:30])
+	}
+}
+
+func TestPacketV1Copy(t *testing.T) {
+	client := newTestSigningClient("ridfebb9")
+
+	original, _ := NewPacketV1(client, nil)
+	original.SetType(DataPacket)
+	original.SetFlags(FlagReliable)
+	original.SetSequenceID(5)
+	original.SetConnectionSignature([]byte{0x01, 0x02, 0x03, 0x04})
+	original.SetPayload([]byte{0x0A, 0x0B, 0x0C})
+
+	copied := original.Copy().(*PacketV1)
+
+	if copied.Sender() != client {
+		t.Error("Copy does not share the sender")
+	}
+
+	copied.AddFlag(FlagNeedsAck)
+	copied.SetSequenceID(6)
+	copied.ConnectionSignature()[0] = 0xFF
+	copied.Payload()[0] = 0xFF
+	copied.SetSubstreamID(1)
+
+	if original.Flags() != FlagReliable || original.SequenceID() != 5 || original.SubstreamID() != 0 {
+		t.Errorf("Original header changed, flags %X sequence ID %d substream ID %d", original.Flags(), original.SequenceID(), original.SubstreamID())
+	}
+
+	if !bytes.Equal(original.ConnectionSignature(), []byte{0x01, 0x02, 0x03, 0x04}) {
+		t.Errorf("Original connection signature changed to % X", original.ConnectionSignature())
+	}
+
+	if !bytes.Equal(original.Payload(), []byte{0x0A, 0x0B, 0x0C}) {
+		t.Errorf("Original payload changed to % X", original.Payload())
+	}
+}
+
+func TestPacketV1TrailingData(t *testing.T) {
+	client := newTestSigningClient("ridfebb9")
+
+	packet, _ := NewPacketV1(client, nil)
+	packet.SetVersion(1)
+	packet.SetSource(0xAF)
+	packet.SetDestination(0xA1)
+	packet.SetType(SynPacket)
+	packet.SetFlags(FlagNeedsAck)
+	packet.SetConnectionSignature(make([]byte, 16))
+
+	data := append(packet.Bytes(), 0xDE, 0xAD, 0xBE, 0xEF)
+
+	decoded, err := NewPacketV1(client, data)
+
+	if err != nil {
+		t.Fatalf("Expected trailing data to be ignored by default, got %v", err)
+	}
+
+	if decoded.Type() != SynPacket {
+		t.Errorf("Expected a SYN packet, got type %d", decoded.Type())
+	}
+
+	client.Server().SetStrictDatagramParsing(true)
+
+	if _, err := NewPacketV1(client, data); err == nil {
+		t.Error("Expected an error for trailing data with strict datagram parsing")
+	}
+
+	if _, err := NewPacketV1(client, data[:len(data)-4]); err != nil {
+		t.Errorf("Expected a packet without trailing data to decode with strict datagram parsing, got %v", err)
+	}
+}
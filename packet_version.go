@@ -0,0 +1,20 @@
+package nex
+
+import (
+	"bytes"
+	"errors"
+)
+
+// PeekPRUDPVersion returns the PRUDP version of the given raw datagram, based on its magic bytes, without parsing it.
+// Datagrams starting with the PRUDPv1 magic (0xEA 0xD0) are version 1, and any others are version 0
+func PeekPRUDPVersion(data []byte) (int, error) {
+	if len(data) < 2 {
+		return 0, errors.New("[PRUDP] Datagram too short to contain a PRUDP header")
+	}
+
+	if bytes.Equal(data[:2], []byte{0xEA, 0xD0}) {
+		return 1, nil
+	}
+
+	return 0, nil
+}
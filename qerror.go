@@ -0,0 +1,290 @@
+package nex
+
+import "fmt"
+
+// QError represents a NEX result code, as sent in RMC error responses.
+// The top bit is set for errors, the next 15 bits are the namespace, and the low 16 bits are the code within that namespace
+type QError uint32
+
+// QErrorNamespace represents the namespace (module) a QError belongs to
+type QErrorNamespace uint16
+
+const (
+	// QErrorNamespaceCore is the namespace for core errors
+	QErrorNamespaceCore QErrorNamespace = 0x0001
+
+	// QErrorNamespaceDDL is the namespace for DDL (data serialization) errors
+	QErrorNamespaceDDL QErrorNamespace = 0x0002
+
+	// QErrorNamespaceRendezVous is the namespace for RendezVous errors
+	QErrorNamespaceRendezVous QErrorNamespace = 0x0003
+
+	// QErrorNamespacePythonCore is the namespace for PythonCore errors
+	QErrorNamespacePythonCore QErrorNamespace = 0x0004
+
+	// QErrorNamespaceTransport is the namespace for transport errors
+	QErrorNamespaceTransport QErrorNamespace = 0x0005
+
+	// QErrorNamespaceDOCore is the namespace for DOCore errors
+	QErrorNamespaceDOCore QErrorNamespace = 0x0006
+
+	// QErrorNamespaceAuthentication is the namespace for authentication errors
+	QErrorNamespaceAuthentication QErrorNamespace = 0x0068
+)
+
+const (
+	// QErrorCoreUnknown is Core::Unknown
+	QErrorCoreUnknown QError = 0x80010001
+
+	// QErrorCoreNotImplemented is Core::NotImplemented
+	QErrorCoreNotImplemented QError = 0x80010002
+
+	// QErrorCoreInvalidPointer is Core::InvalidPointer
+	QErrorCoreInvalidPointer QError = 0x80010003
+
+	// QErrorCoreOperationAborted is Core::OperationAborted
+	QErrorCoreOperationAborted QError = 0x80010004
+
+	// QErrorCoreException is Core::Exception
+	QErrorCoreException QError = 0x80010005
+
+	// QErrorCoreAccessDenied is Core::AccessDenied
+	QErrorCoreAccessDenied QError = 0x80010006
+
+	// QErrorCoreInvalidHandle is Core::InvalidHandle
+	QErrorCoreInvalidHandle QError = 0x80010007
+
+	// QErrorCoreInvalidIndex is Core::InvalidIndex
+	QErrorCoreInvalidIndex QError = 0x80010008
+
+	// QErrorCoreOutOfMemory is Core::OutOfMemory
+	QErrorCoreOutOfMemory QError = 0x80010009
+
+	// QErrorCoreInvalidArgument is Core::InvalidArgument
+	QErrorCoreInvalidArgument QError = 0x8001000A
+
+	// QErrorCoreTimeout is Core::Timeout
+	QErrorCoreTimeout QError = 0x8001000B
+
+	// QErrorCoreInitializationFailure is Core::InitializationFailure
+	QErrorCoreInitializationFailure QError = 0x8001000C
+
+	// QErrorCoreCallInitiationFailure is Core::CallInitiationFailure
+	QErrorCoreCallInitiationFailure QError = 0x8001000D
+
+	// QErrorCoreRegistrationError is Core::RegistrationError
+	QErrorCoreRegistrationError QError = 0x8001000E
+
+	// QErrorCoreBufferOverflow is Core::BufferOverflow
+	QErrorCoreBufferOverflow QError = 0x8001000F
+
+	// QErrorCoreInvalidLockState is Core::InvalidLockState
+	QErrorCoreInvalidLockState QError = 0x80010010
+
+	// QErrorCoreInvalidSequence is Core::InvalidSequence
+	QErrorCoreInvalidSequence QError = 0x80010011
+
+	// QErrorCoreSystemError is Core::SystemError
+	QErrorCoreSystemError QError = 0x80010012
+
+	// QErrorCoreCancelled is Core::Cancelled
+	QErrorCoreCancelled QError = 0x80010013
+
+	// QErrorDDLInvalidSignature is DDL::InvalidSignature
+	QErrorDDLInvalidSignature QError = 0x80020001
+
+	// QErrorDDLIncorrectVersion is DDL::IncorrectVersion
+	QErrorDDLIncorrectVersion QError = 0x80020002
+
+	// QErrorRendezVousConnectionFailure is RendezVous::ConnectionFailure
+	QErrorRendezVousConnectionFailure QError = 0x80030001
+
+	// QErrorRendezVousNotAuthenticated is RendezVous::NotAuthenticated
+	QErrorRendezVousNotAuthenticated QError = 0x80030002
+
+	// QErrorRendezVousInvalidUsername is RendezVous::InvalidUsername
+	QErrorRendezVousInvalidUsername QError = 0x80030064
+
+	// QErrorRendezVousInvalidPassword is RendezVous::InvalidPassword
+	QErrorRendezVousInvalidPassword QError = 0x80030065
+
+	// QErrorRendezVousUsernameAlreadyExists is RendezVous::UsernameAlreadyExists
+	QErrorRendezVousUsernameAlreadyExists QError = 0x80030066
+
+	// QErrorRendezVousAccountDisabled is RendezVous::AccountDisabled
+	QErrorRendezVousAccountDisabled QError = 0x80030067
+
+	// QErrorRendezVousAccountExpired is RendezVous::AccountExpired
+	QErrorRendezVousAccountExpired QError = 0x80030068
+
+	// QErrorRendezVousConcurrentLoginDenied is RendezVous::ConcurrentLoginDenied
+	QErrorRendezVousConcurrentLoginDenied QError = 0x80030069
+
+	// QErrorRendezVousEncryptionFailure is RendezVous::EncryptionFailure
+	QErrorRendezVousEncryptionFailure QError = 0x8003006A
+
+	// QErrorRendezVousInvalidPID is RendezVous::InvalidPID
+	QErrorRendezVousInvalidPID QError = 0x8003006B
+
+	// QErrorRendezVousMaxConnectionsReached is RendezVous::MaxConnectionsReached
+	QErrorRendezVousMaxConnectionsReached QError = 0x8003006C
+
+	// QErrorRendezVousInvalidGID is RendezVous::InvalidGID
+	QErrorRendezVousInvalidGID QError = 0x8003006D
+
+	// QErrorRendezVousSessionVoid is RendezVous::SessionVoid
+	QErrorRendezVousSessionVoid QError = 0x80030073
+
+	// QErrorRendezVousSessionFull is RendezVous::SessionFull
+	QErrorRendezVousSessionFull QError = 0x800300C8
+
+	// QErrorRendezVousPermissionDenied is RendezVous::PermissionDenied
+	QErrorRendezVousPermissionDenied QError = 0x800300D9
+
+	// QErrorRendezVousNotFriend is RendezVous::NotFriend
+	QErrorRendezVousNotFriend QError = 0x800300DA
+
+	// QErrorTransportUnknown is Transport::Unknown
+	QErrorTransportUnknown QError = 0x80050001
+
+	// QErrorTransportConnectionFailure is Transport::ConnectionFailure
+	QErrorTransportConnectionFailure QError = 0x80050002
+
+	// QErrorTransportInvalidURL is Transport::InvalidUrl
+	QErrorTransportInvalidURL QError = 0x80050003
+
+	// QErrorTransportInvalidKey is Transport::InvalidKey
+	QErrorTransportInvalidKey QError = 0x80050004
+
+	// QErrorTransportTimeout is Transport::Timeout
+	QErrorTransportTimeout QError = 0x80050008
+
+	// QErrorTransportConnectionReset is Transport::ConnectionReset
+	QErrorTransportConnectionReset QError = 0x80050009
+
+	// QErrorTransportDecompressionFailure is Transport::DecompressionFailure
+	QErrorTransportDecompressionFailure QError = 0x8005000C
+
+	// QErrorAuthenticationNASAuthenticateError is Authentication::NASAuthenticateError
+	QErrorAuthenticationNASAuthenticateError QError = 0x80680001
+
+	// QErrorAuthenticationTokenParseError is Authentication::TokenParseError
+	QErrorAuthenticationTokenParseError QError = 0x80680002
+
+	// QErrorAuthenticationTokenExpired is Authentication::TokenExpired
+	QErrorAuthenticationTokenExpired QError = 0x80680006
+
+	// QErrorAuthenticationValidationFailed is Authentication::ValidationFailed
+	QErrorAuthenticationValidationFailed QError = 0x80680007
+
+	// QErrorAuthenticationInvalidParam is Authentication::InvalidParam
+	QErrorAuthenticationInvalidParam QError = 0x80680008
+
+	// QErrorAuthenticationPrincipalIDUnmatched is Authentication::PrincipalIdUnmatched
+	QErrorAuthenticationPrincipalIDUnmatched QError = 0x80680009
+
+	// QErrorAuthenticationUnderMaintenance is Authentication::UnderMaintenance
+	QErrorAuthenticationUnderMaintenance QError = 0x8068000B
+
+	// QErrorAuthenticationUnknown is Authentication::Unknown
+	QErrorAuthenticationUnknown QError = 0x8068000E
+)
+
+var qErrorNamespaceNames = map[QErrorNamespace]string{
+	QErrorNamespaceCore:           "Core",
+	QErrorNamespaceDDL:            "DDL",
+	QErrorNamespaceRendezVous:     "RendezVous",
+	QErrorNamespacePythonCore:     "PythonCore",
+	QErrorNamespaceTransport:      "Transport",
+	QErrorNamespaceDOCore:         "DOCore",
+	QErrorNamespaceAuthentication: "Authentication",
+}
+
+var qErrorNames = map[QError]string{
+	QErrorCoreUnknown:                        "Unknown",
+	QErrorCoreNotImplemented:                 "NotImplemented",
+	QErrorCoreInvalidPointer:                 "InvalidPointer",
+	QErrorCoreOperationAborted:               "OperationAborted",
+	QErrorCoreException:                      "Exception",
+	QErrorCoreAccessDenied:                   "AccessDenied",
+	QErrorCoreInvalidHandle:                  "InvalidHandle",
+	QErrorCoreInvalidIndex:                   "InvalidIndex",
+	QErrorCoreOutOfMemory:                    "OutOfMemory",
+	QErrorCoreInvalidArgument:                "InvalidArgument",
+	QErrorCoreTimeout:                        "Timeout",
+	QErrorCoreInitializationFailure:          "InitializationFailure",
+	QErrorCoreCallInitiationFailure:          "CallInitiationFailure",
+	QErrorCoreRegistrationError:              "RegistrationError",
+	QErrorCoreBufferOverflow:                 "BufferOverflow",
+	QErrorCoreInvalidLockState:               "InvalidLockState",
+	QErrorCoreInvalidSequence:                "InvalidSequence",
+	QErrorCoreSystemError:                    "SystemError",
+	QErrorCoreCancelled:                      "Cancelled",
+	QErrorDDLInvalidSignature:                "InvalidSignature",
+	QErrorDDLIncorrectVersion:                "IncorrectVersion",
+	QErrorRendezVousConnectionFailure:        "ConnectionFailure",
+	QErrorRendezVousNotAuthenticated:         "NotAuthenticated",
+	QErrorRendezVousInvalidUsername:          "InvalidUsername",
+	QErrorRendezVousInvalidPassword:          "InvalidPassword",
+	QErrorRendezVousUsernameAlreadyExists:    "UsernameAlreadyExists",
+	QErrorRendezVousAccountDisabled:          "AccountDisabled",
+	QErrorRendezVousAccountExpired:           "AccountExpired",
+	QErrorRendezVousConcurrentLoginDenied:    "ConcurrentLoginDenied",
+	QErrorRendezVousEncryptionFailure:        "EncryptionFailure",
+	QErrorRendezVousInvalidPID:               "InvalidPID",
+	QErrorRendezVousMaxConnectionsReached:    "MaxConnectionsReached",
+	QErrorRendezVousInvalidGID:               "InvalidGID",
+	QErrorRendezVousSessionVoid:              "SessionVoid",
+	QErrorRendezVousSessionFull:              "SessionFull",
+	QErrorRendezVousPermissionDenied:         "PermissionDenied",
+	QErrorRendezVousNotFriend:                "NotFriend",
+	QErrorTransportUnknown:                   "Unknown",
+	QErrorTransportConnectionFailure:         "ConnectionFailure",
+	QErrorTransportInvalidURL:                "InvalidUrl",
+	QErrorTransportInvalidKey:                "InvalidKey",
+	QErrorTransportTimeout:                   "Timeout",
+	QErrorTransportConnectionReset:           "ConnectionReset",
+	QErrorTransportDecompressionFailure:      "DecompressionFailure",
+	QErrorAuthenticationNASAuthenticateError: "NASAuthenticateError",
+	QErrorAuthenticationTokenParseError:      "TokenParseError",
+	QErrorAuthenticationTokenExpired:         "TokenExpired",
+	QErrorAuthenticationValidationFailed:     "ValidationFailed",
+	QErrorAuthenticationInvalidParam:         "InvalidParam",
+	QErrorAuthenticationPrincipalIDUnmatched: "PrincipalIdUnmatched",
+	QErrorAuthenticationUnderMaintenance:     "UnderMaintenance",
+	QErrorAuthenticationUnknown:              "Unknown",
+}
+
+// String returns the namespace name, or its hex value if it is not known
+func (namespace QErrorNamespace) String() string {
+	if name, ok := qErrorNamespaceNames[namespace]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("0x%04X", uint16(namespace))
+}
+
+// Namespace returns the namespace the QError belongs to
+func (qerror QError) Namespace() QErrorNamespace {
+	return QErrorNamespace((qerror >> 16) & 0x7FFF)
+}
+
+// Code returns the code of the QError within its namespace
+func (qerror QError) Code() uint16 {
+	return uint16(qerror & 0xFFFF)
+}
+
+// IsSuccess reports whether the QError is a success result, which is the case when the error bit is not set
+func (qerror QError) IsSuccess() bool {
+	return qerror&0x80000000 == 0
+}
+
+// String returns the QError as Namespace::Name, such as Core::NotImplemented.
+// Codes without a known name are formatted as hex
+func (qerror QError) String() string {
+	if name, ok := qErrorNames[qerror]; ok {
+		return qerror.Namespace().String() + "::" + name
+	}
+
+	return fmt.Sprintf("0x%08X", uint32(qerror))
+}
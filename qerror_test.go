@@ -0,0 +1,61 @@
+package nex
+
+import "testing"
+
+func TestQErrorNames(t *testing.T) {
+	tests := []struct {
+		qerror    QError
+		name      string
+		namespace QErrorNamespace
+		code      uint16
+	}{
+		{QErrorCoreNotImplemented, "Core::NotImplemented", QErrorNamespaceCore, 0x0002},
+		{QErrorDDLInvalidSignature, "DDL::InvalidSignature", QErrorNamespaceDDL, 0x0001},
+		{QErrorRendezVousPermissionDenied, "RendezVous::PermissionDenied", QErrorNamespaceRendezVous, 0x00D9},
+		{QErrorAuthenticationTokenExpired, "Authentication::TokenExpired", QErrorNamespaceAuthentication, 0x0006},
+		{QError(0x8001FFFF), "0x8001FFFF", QErrorNamespaceCore, 0xFFFF},
+	}
+
+	for _, test := range tests {
+		if test.qerror.String() != test.name {
+			t.Errorf("%08X: expected name %q, got %q", uint32(test.qerror), test.name, test.qerror.String())
+		}
+
+		if test.qerror.Namespace() != test.namespace || test.qerror.Code() != test.code {
+			t.Errorf("%08X: expected namespace %s code %X, got %s and %X", uint32(test.qerror), test.namespace, test.code, test.qerror.Namespace(), test.qerror.Code())
+		}
+
+		if test.qerror.IsSuccess() {
+			t.Errorf("%08X: error reported as success", uint32(test.qerror))
+		}
+	}
+
+	if !QError(0x00010001).IsSuccess() {
+		t.Error("Result without the error bit reported as an error")
+	}
+}
+
+func TestQErrorRMCResponseRoundTrip(t *testing.T) {
+	response := NewRMCErrorResponse(0x0A, 3, uint32(QErrorRendezVousPermissionDenied))
+
+	body, err := NewStreamIn(response.Bytes(), nil).ReadBuffer()
+
+	if err != nil {
+		t.Fatalf("Failed to read the response body: %v", err)
+	}
+
+	stream := NewStreamIn(body, nil)
+
+	protocolID := stream.ReadUInt8()
+	success := stream.ReadUInt8()
+	qerror := QError(stream.ReadUInt32LE())
+	callID := stream.ReadUInt32LE()
+
+	if protocolID != 0x0A || success != 0 || callID != 3 {
+		t.Errorf("Unexpected RMC error response: protocol %X success %d call %d", protocolID, success, callID)
+	}
+
+	if qerror != QErrorRendezVousPermissionDenied || qerror.String() != "RendezVous::PermissionDenied" {
+		t.Errorf("Expected RendezVous::PermissionDenied, got %s", qerror)
+	}
+}
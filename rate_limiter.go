@@ -0,0 +1,96 @@
+package nex
+
+import (
+	"sync"
+	"time"
+)
+
+type tokenBucket struct {
+	tokens   float64
+	lastSeen time.Time
+}
+
+// RateLimiter is a token bucket rate limiter which limits how many packets may be accepted per second for each key
+type RateLimiter struct {
+	sync.Mutex
+	perSecond int
+	burst     int
+	buckets   map[string]*tokenBucket
+	lastPrune time.Time
+	clock     func() time.Time
+}
+
+// Allow reports whether a packet for the given key is within the rate limit, using up a token if it is
+func (limiter *RateLimiter) Allow(key string) bool {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	now := limiter.clock()
+
+	bucket, ok := limiter.buckets[key]
+
+	if !ok {
+		bucket = &tokenBucket{
+			tokens:   float64(limiter.burst),
+			lastSeen: now,
+		}
+
+		limiter.buckets[key] = bucket
+	} else {
+		bucket.tokens += now.Sub(bucket.lastSeen).Seconds() * float64(limiter.perSecond)
+		bucket.lastSeen = now
+
+		if bucket.tokens > float64(limiter.burst) {
+			bucket.tokens = float64(limiter.burst)
+		}
+	}
+
+	if now.Sub(limiter.lastPrune) > time.Minute {
+		limiter.prune(now)
+	}
+
+	if bucket.tokens < 1 {
+		return false
+	}
+
+	bucket.tokens--
+
+	return true
+}
+
+// SetClock sets the function used to get the current time. Setting it to nil restores time.Now
+func (limiter *RateLimiter) SetClock(clock func() time.Time) {
+	limiter.Lock()
+	defer limiter.Unlock()
+
+	if clock == nil {
+		clock = time.Now
+	}
+
+	limiter.clock = clock
+	limiter.lastPrune = clock()
+}
+
+// prune removes the buckets which have refilled completely, as they are no different from a new bucket
+func (limiter *RateLimiter) prune(now time.Time) {
+	for key, bucket := range limiter.buckets {
+		refilled := bucket.tokens + now.Sub(bucket.lastSeen).Seconds()*float64(limiter.perSecond)
+
+		if refilled >= float64(limiter.burst) {
+			delete(limiter.buckets, key)
+		}
+	}
+
+	limiter.lastPrune = now
+}
+
+// NewRateLimiter returns a new RateLimiter allowing perSecond packets per second per key, with bursts of up to burst packets
+func NewRateLimiter(perSecond int, burst int) *RateLimiter {
+	return &RateLimiter{
+		perSecond: perSecond,
+		burst:     burst,
+		buckets:   make(map[string]*tokenBucket),
+		lastPrune: time.Now(),
+		clock:     time.Now,
+	}
+}
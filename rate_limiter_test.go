@@ -0,0 +1,108 @@
+package nex
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateLimiterRefill(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	limiter := NewRateLimiter(2, 3)
+	limiter.SetClock(func() time.Time { return now })
+
+	for i := 0; i < 3; i++ {
+		if !limiter.Allow("a") {
+			t.Fatalf("Packet %d of the burst was limited", i)
+		}
+	}
+
+	if limiter.Allow("a") {
+		t.Error("Packet over the burst was allowed")
+	}
+
+	// Keys have their own buckets
+	if !limiter.Allow("b") {
+		t.Error("Packet for another key was limited")
+	}
+
+	now = now.Add(500 * time.Millisecond)
+
+	if !limiter.Allow("a") {
+		t.Error("Packet was limited after a token was refilled")
+	}
+
+	if limiter.Allow("a") {
+		t.Error("Packet was allowed with no tokens left")
+	}
+}
+
+func TestServerPacketRateLimit(t *testing.T) {
+	dropped := make(chan string, 8)
+
+	server := newTestServer(t, func(server *Server) {
+		server.SetPacketRateLimit(1, 3)
+
+		server.OnPacketDropped(func(address *net.UDPAddr, reason string) {
+			dropped <- reason
+		})
+	})
+
+	client := newTestClient(t, server)
+
+	for i := 0; i < 3; i++ {
+		client.syn()
+	}
+
+	for i := 0; i < 2; i++ {
+		syn := client.newPacket(SynPacket, FlagNeedsAck)
+		syn.SetSessionID(0)
+		syn.SetConnectionSignature(make([]byte, 16))
+		client.sendPacket(syn)
+
+		select {
+		case reason := <-dropped:
+			if reason != "Address packet rate limit exceeded" {
+				t.Errorf("Unexpected drop reason %q", reason)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("Timed out waiting for the SYN over the rate limit to be dropped")
+		}
+	}
+}
+
+func TestServerGlobalRateLimit(t *testing.T) {
+	dropped := make(chan string, 8)
+
+	server := newTestServer(t, func(server *Server) {
+		server.SetGlobalRateLimit(1, 2)
+
+		server.OnPacketDropped(func(address *net.UDPAddr, reason string) {
+			dropped <- reason
+		})
+	})
+
+	// The limit is shared by every address
+	first := newTestClient(t, server)
+	second := newTestClient(t, server)
+
+	first.syn()
+	second.syn()
+
+	for _, client := range []*testClient{first, second} {
+		syn := client.newPacket(SynPacket, FlagNeedsAck)
+		syn.SetSessionID(0)
+		syn.SetConnectionSignature(make([]byte, 16))
+		client.sendPacket(syn)
+
+		select {
+		case reason := <-dropped:
+			if reason != "Global packet rate limit exceeded" {
+				t.Errorf("Unexpected drop reason %q", reason)
+			}
+		case <-time.After(testTimeout):
+			t.Fatal("Timed out waiting for the SYN over the global rate limit to be dropped")
+		}
+	}
+}
@@ -0,0 +1,335 @@
+package nex
+
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PendingPacket represents a reliable packet which has been sent but not yet acknowledged
+type PendingPacket struct {
+	sequenceID uint16
+	data       []byte
+	timer      *clockTimer
+	iterations int
+	tracker    *reliableSendTracker
+}
+
+// SequenceID returns the sequence ID of the pending packet
+func (pendingPacket *PendingPacket) SequenceID() uint16 {
+	return pendingPacket.sequenceID
+}
+
+// Iterations returns the number of times the pending packet has been resent
+func (pendingPacket *PendingPacket) Iterations() int {
+	return pendingPacket.iterations
+}
+
+func (pendingPacket *PendingPacket) acknowledged() {
+	if pendingPacket.tracker != nil {
+		pendingPacket.tracker.acknowledged()
+	}
+}
+
+func (pendingPacket *PendingPacket) timedOut() {
+	if pendingPacket.tracker != nil {
+		pendingPacket.tracker.timedOut()
+	}
+}
+
+// reliableSendTracker tracks the acknowledgement of every fragment of a packet sent with SendReliable
+type reliableSendTracker struct {
+	sync.Mutex
+	remaining int
+	done      bool
+	onAck     func()
+	onTimeout func()
+}
+
+func (tracker *reliableSendTracker) acknowledged() {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	if tracker.done {
+		return
+	}
+
+	tracker.remaining--
+
+	if tracker.remaining == 0 {
+		tracker.done = true
+
+		if tracker.onAck != nil {
+			go tracker.onAck()
+		}
+	}
+}
+
+func (tracker *reliableSendTracker) timedOut() {
+	tracker.Lock()
+	defer tracker.Unlock()
+
+	if tracker.done {
+		return
+	}
+
+	tracker.done = true
+
+	if tracker.onTimeout != nil {
+		go tracker.onTimeout()
+	}
+}
+
+// ResendScheduler resends the reliable packets sent to a client until they are acknowledged
+type ResendScheduler struct {
+	sync.Mutex
+	client  *Client
+	packets map[uint16]*PendingPacket
+	queue   []*PendingPacket
+	paused  bool
+}
+
+// AddPacket schedules the encoded packet to be resent until it is acknowledged.
+// It returns false if the scheduler is paused or the reliable window is full, in which case the packet is queued and
+// sent by the scheduler once it is resumed or acknowledgements free up space
+func (scheduler *ResendScheduler) AddPacket(sequenceID uint16, data []byte) bool {
+	return scheduler.addPacket(sequenceID, data, nil)
+}
+
+func (scheduler *ResendScheduler) addPacket(sequenceID uint16, data []byte, tracker *reliableSendTracker) bool {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	pendingPacket := &PendingPacket{
+		sequenceID: sequenceID,
+		data:       data,
+		tracker:    tracker,
+	}
+
+	if scheduler.paused || len(scheduler.queue) > 0 || scheduler.windowFull() {
+		scheduler.queue = append(scheduler.queue, pendingPacket)
+		return false
+	}
+
+	scheduler.schedulePacket(pendingPacket)
+
+	return true
+}
+
+// schedulePacket starts the resend timer of a packet which is being sent. The scheduler must be locked
+func (scheduler *ResendScheduler) schedulePacket(pendingPacket *PendingPacket) {
+	if previousPacket, ok := scheduler.packets[pendingPacket.sequenceID]; ok {
+		previousPacket.timer.Stop()
+	}
+
+	pendingPacket.timer = newClockTimer(scheduler.client.Server(), scheduler.resendDelay(), func() {
+		scheduler.resendPacket(pendingPacket)
+	})
+
+	scheduler.packets[pendingPacket.sequenceID] = pendingPacket
+}
+
+// windowFull reports whether the number of unacknowledged packets has reached the reliable window size. The scheduler must be locked
+func (scheduler *ResendScheduler) windowFull() bool {
+	windowSize := scheduler.client.Server().ReliableWindowSize()
+
+	return windowSize > 0 && len(scheduler.packets) >= windowSize
+}
+
+// advanceWindow schedules queued packets while there is space in the reliable window, returning them so
+// they can be sent once the scheduler is unlocked. The scheduler must be locked
+func (scheduler *ResendScheduler) advanceWindow() []*PendingPacket {
+	var ready []*PendingPacket
+
+	for !scheduler.paused && len(scheduler.queue) > 0 && !scheduler.windowFull() {
+		pendingPacket := scheduler.queue[0]
+		scheduler.queue = scheduler.queue[1:]
+
+		scheduler.schedulePacket(pendingPacket)
+		ready = append(ready, pendingPacket)
+	}
+
+	return ready
+}
+
+func (scheduler *ResendScheduler) sendPackets(pendingPackets []*PendingPacket) {
+	for _, pendingPacket := range pendingPackets {
+		scheduler.client.Server().SendRaw(scheduler.client.Address(), pendingPacket.data)
+	}
+}
+
+// AcknowledgePacket stops resending the packet with the given sequence ID
+func (scheduler *ResendScheduler) AcknowledgePacket(sequenceID uint16) {
+	scheduler.Lock()
+
+	if pendingPacket, ok := scheduler.packets[sequenceID]; ok {
+		pendingPacket.timer.Stop()
+		pendingPacket.acknowledged()
+		delete(scheduler.packets, sequenceID)
+	}
+
+	ready := scheduler.advanceWindow()
+
+	scheduler.Unlock()
+
+	scheduler.sendPackets(ready)
+}
+
+// AcknowledgePacketsUpTo stops resending every packet with a sequence ID up to and including the given one
+func (scheduler *ResendScheduler) AcknowledgePacketsUpTo(sequenceID uint16) {
+	scheduler.Lock()
+
+	for pendingSequenceID, pendingPacket := range scheduler.packets {
+		// Compare as a signed difference so the check holds across sequence ID wrap-around
+		if int16(pendingSequenceID-sequenceID) <= 0 {
+			pendingPacket.timer.Stop()
+			pendingPacket.acknowledged()
+			delete(scheduler.packets, pendingSequenceID)
+		}
+	}
+
+	ready := scheduler.advanceWindow()
+
+	scheduler.Unlock()
+
+	scheduler.sendPackets(ready)
+}
+
+// ResendAll resends every sent packet which is still awaiting acknowledgement immediately, in sequence ID order.
+// Their resend timers are restarted so they are not resent again by the timer straight away. Forced resends don't count
+// towards the resend limit. Packets queued behind the reliable window are not sent
+func (scheduler *ResendScheduler) ResendAll() {
+	scheduler.Lock()
+
+	pendingPackets := make([]*PendingPacket, 0, len(scheduler.packets))
+
+	for _, pendingPacket := range scheduler.packets {
+		pendingPacket.timer.Reset(scheduler.resendDelay())
+		pendingPackets = append(pendingPackets, pendingPacket)
+	}
+
+	scheduler.Unlock()
+
+	sort.Slice(pendingPackets, func(i, j int) bool {
+		return pendingPackets[i].sequenceID < pendingPackets[j].sequenceID
+	})
+
+	scheduler.sendPackets(pendingPackets)
+}
+
+// Pause holds new reliable packets in the queue instead of sending them, such as while the connection is congested.
+// Packets which were already sent are still resent until they are acknowledged
+func (scheduler *ResendScheduler) Pause() {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	scheduler.paused = true
+}
+
+// Resume sends the packets queued while the scheduler was paused, as far as the reliable window allows
+func (scheduler *ResendScheduler) Resume() {
+	scheduler.Lock()
+
+	scheduler.paused = false
+	ready := scheduler.advanceWindow()
+
+	scheduler.Unlock()
+
+	scheduler.sendPackets(ready)
+}
+
+// PendingSequenceIDs returns a sorted snapshot of the sequence IDs which have been sent and are still awaiting acknowledgement.
+// Packets queued because the reliable window is full are not included
+func (scheduler *ResendScheduler) PendingSequenceIDs() []uint16 {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	sequenceIDs := make([]uint16, 0, len(scheduler.packets))
+
+	for sequenceID := range scheduler.packets {
+		sequenceIDs = append(sequenceIDs, sequenceID)
+	}
+
+	sort.Slice(sequenceIDs, func(i, j int) bool {
+		return sequenceIDs[i] < sequenceIDs[j]
+	})
+
+	return sequenceIDs
+}
+
+// Stop stops resending all pending packets
+func (scheduler *ResendScheduler) Stop() {
+	scheduler.Lock()
+	defer scheduler.Unlock()
+
+	for sequenceID, pendingPacket := range scheduler.packets {
+		pendingPacket.timer.Stop()
+		pendingPacket.timedOut()
+		delete(scheduler.packets, sequenceID)
+	}
+
+	for _, pendingPacket := range scheduler.queue {
+		pendingPacket.timedOut()
+	}
+
+	scheduler.queue = nil
+}
+
+func (scheduler *ResendScheduler) resendPacket(pendingPacket *PendingPacket) {
+	server := scheduler.client.Server()
+
+	// Checked before locking the scheduler, as Kick stops the scheduler while holding the clients lock
+	connected := server.ClientConnected(scheduler.client)
+
+	scheduler.Lock()
+
+	if scheduler.packets[pendingPacket.sequenceID] != pendingPacket {
+		// Acknowledged or replaced while the timer was firing
+		scheduler.Unlock()
+		return
+	}
+
+	if !connected {
+		// The client was kicked while the timer was firing
+		pendingPacket.timedOut()
+		delete(scheduler.packets, pendingPacket.sequenceID)
+		scheduler.Unlock()
+		return
+	}
+
+	if pendingPacket.iterations >= server.ResendMaxIterations() {
+		pendingPacket.timedOut()
+		delete(scheduler.packets, pendingPacket.sequenceID)
+		scheduler.Unlock()
+		return
+	}
+
+	pendingPacket.iterations++
+	pendingPacket.timer.Reset(scheduler.resendDelay())
+
+	scheduler.Unlock()
+
+	server.SendRaw(scheduler.client.Address(), pendingPacket.data)
+}
+
+// resendDelay returns the resend timeout plus a random amount of jitter, so that packets
+// which timed out together are not all retransmitted in the same burst
+func (scheduler *ResendScheduler) resendDelay() time.Duration {
+	server := scheduler.client.Server()
+	delay := server.ResendTimeout()
+
+	if jitter := server.ResendJitter(); jitter > 0 {
+		delay += rand.Float32() * jitter
+	}
+
+	return time.Duration(delay * float32(time.Second))
+}
+
+// NewResendScheduler returns a new ResendScheduler for the given client
+func NewResendScheduler(client *Client) *ResendScheduler {
+	return &ResendScheduler{
+		client:  client,
+		packets: make(map[uint16]*PendingPacket),
+	}
+}
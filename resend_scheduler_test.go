@@ -0,0 +1,298 @@
+package nex
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestResendDelayJitter(t *testing.T) {
+	server := NewServer()
+	server.SetResendTimeout(1)
+	server.SetResendJitter(0.5)
+
+	client := NewClient(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60000}, server)
+	scheduler := client.ResendScheduler()
+
+	delays := make(map[time.Duration]bool)
+
+	for i := 0; i < 100; i++ {
+		delay := scheduler.resendDelay()
+
+		if delay < time.Second || delay > 1500*time.Millisecond {
+			t.Fatalf("Resend delay %s is outside of the jitter window", delay)
+		}
+
+		delays[delay] = true
+	}
+
+	if len(delays) < 2 {
+		t.Error("Every resend delay was identical")
+	}
+
+	server.SetResendJitter(0)
+
+	if delay := scheduler.resendDelay(); delay != time.Second {
+		t.Errorf("Expected a resend delay of 1s without jitter, got %s", delay)
+	}
+}
+
+func TestResendMaxIterations(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetResendTimeout(0.01)
+		server.SetResendJitter(0)
+		server.SetResendMaxIterations(3)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	timedOut := make(chan struct{})
+
+	packet, _ := NewPacketV1(client.client, nil)
+	packet.SetSource(0xA1)
+	packet.SetDestination(0xAF)
+	packet.SetType(DataPacket)
+	packet.SetPayload([]byte{0x01, 0x02, 0x03})
+
+	server.SendReliable(packet, nil, func() {
+		close(timedOut)
+	})
+
+	// Sent once, then resent until the limit since it is never acknowledged
+	sequenceID := client.receive().SequenceID()
+
+	for i := 0; i < 3; i++ {
+		resent := client.receive()
+
+		if resent.SequenceID() != sequenceID {
+			t.Fatalf("Expected a resend of packet %d, got packet %d", sequenceID, resent.SequenceID())
+		}
+	}
+
+	select {
+	case <-timedOut:
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the packet to be given up on")
+	}
+
+	client.expectNothing(100 * time.Millisecond)
+}
+
+func TestResendAfterKickSendsNothing(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetResendTimeout(0.01)
+		server.SetResendJitter(0)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	packet, _ := NewPacketV1(client.client, nil)
+	packet.SetSource(0xA1)
+	packet.SetDestination(0xAF)
+	packet.SetType(DataPacket)
+	packet.SetPayload([]byte{0x01, 0x02, 0x03})
+	packet.SetSequenceID(1)
+
+	server.Kick(client.client)
+
+	if server.ClientConnected(client.client) {
+		t.Fatal("Client is still connected after being kicked")
+	}
+
+	// A packet scheduled while the client was being kicked must not be resent to its old address
+	client.client.ResendScheduler().AddPacket(packet.SequenceID(), packet.Bytes())
+
+	server.Send(packet)
+
+	client.expectNothing(100 * time.Millisecond)
+
+	if pending := client.client.ResendScheduler().PendingSequenceIDs(); len(pending) != 0 {
+		t.Errorf("Expected the resend to be dropped, still pending %v", pending)
+	}
+}
+
+func TestSendReliableAcknowledged(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetFragmentSize(8)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	acknowledged := make(chan struct{}, 1)
+	timedOut := make(chan struct{}, 1)
+
+	packet, _ := NewPacketV1(client.client, nil)
+	packet.SetSource(0xA1)
+	packet.SetDestination(0xAF)
+	packet.SetType(DataPacket)
+	packet.SetPayload(make([]byte, 20))
+
+	server.SendReliable(packet, func() {
+		acknowledged <- struct{}{}
+	}, func() {
+		timedOut <- struct{}{}
+	})
+
+	var sequenceIDs []uint16
+
+	for i := 0; i < 3; i++ {
+		sequenceIDs = append(sequenceIDs, client.receive().SequenceID())
+	}
+
+	for i, sequenceID := range sequenceIDs {
+		ack := client.newPacket(DataPacket, FlagAck)
+		ack.SetSequenceID(sequenceID)
+		client.sendPacket(ack)
+
+		if i < len(sequenceIDs)-1 {
+			// Only called once every fragment is acknowledged
+			select {
+			case <-acknowledged:
+				t.Fatalf("Acknowledgement callback called after %d of %d fragments", i+1, len(sequenceIDs))
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+	}
+
+	select {
+	case <-acknowledged:
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the acknowledgement callback")
+	}
+
+	select {
+	case <-timedOut:
+		t.Error("Timeout callback called for an acknowledged packet")
+	default:
+	}
+}
+
+func TestResendPendingSequenceIDs(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetResendTimeout(10)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	var sent []uint16
+
+	for i := 0; i < 3; i++ {
+		packet, _ := NewPacketV1(client.client, nil)
+		packet.SetSource(0xA1)
+		packet.SetDestination(0xAF)
+		packet.SetType(DataPacket)
+		packet.SetPayload([]byte{byte(i)})
+
+		server.SendReliable(packet, nil, nil)
+
+		sent = append(sent, client.receive().SequenceID())
+	}
+
+	scheduler := client.client.ResendScheduler()
+
+	if pending := scheduler.PendingSequenceIDs(); !reflect.DeepEqual(pending, sent) {
+		t.Errorf("Expected pending sequence IDs %v, got %v", sent, pending)
+	}
+
+	scheduler.AcknowledgePacket(sent[1])
+
+	expected := []uint16{sent[0], sent[2]}
+
+	if pending := scheduler.PendingSequenceIDs(); !reflect.DeepEqual(pending, expected) {
+		t.Errorf("Expected pending sequence IDs %v after acknowledging %d, got %v", expected, sent[1], pending)
+	}
+}
+
+func TestResendReliableWindow(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetResendTimeout(10)
+		server.SetReliableWindowSize(2)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	for i := 0; i < 4; i++ {
+		packet, _ := NewPacketV1(client.client, nil)
+		packet.SetSource(0xA1)
+		packet.SetDestination(0xAF)
+		packet.SetType(DataPacket)
+		packet.SetPayload([]byte{byte(i)})
+
+		server.SendReliable(packet, nil, nil)
+	}
+
+	first := client.receive()
+	second := client.receive()
+
+	// The other packets are queued until the window has space
+	client.expectNothing(100 * time.Millisecond)
+
+	if pending := client.client.ResendScheduler().PendingSequenceIDs(); len(pending) != 2 {
+		t.Errorf("Expected 2 packets in flight, got %v", pending)
+	}
+
+	for i, acknowledged := range []*PacketV1{first, second} {
+		ack := client.newPacket(DataPacket, FlagAck)
+		ack.SetSequenceID(acknowledged.SequenceID())
+		client.sendPacket(ack)
+
+		next := client.receive()
+
+		if next.deciphered[0] != byte(i+2) {
+			t.Errorf("Expected packet %d once packet %d was acknowledged, got packet %d", i+2, i, next.deciphered[0])
+		}
+	}
+
+	if first.deciphered[0] != 0 || second.deciphered[0] != 1 {
+		t.Errorf("Expected packets 0 and 1 to be sent first, got %d and %d", first.deciphered[0], second.deciphered[0])
+	}
+}
+
+func TestResendPauseAndResume(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetResendTimeout(10)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	scheduler := client.client.ResendScheduler()
+	scheduler.Pause()
+
+	for i := 0; i < 2; i++ {
+		packet, _ := NewPacketV1(client.client, nil)
+		packet.SetSource(0xA1)
+		packet.SetDestination(0xAF)
+		packet.SetType(DataPacket)
+		packet.SetPayload([]byte{byte(i)})
+
+		server.SendReliable(packet, nil, nil)
+	}
+
+	// Reliable packets are held while paused
+	client.expectNothing(100 * time.Millisecond)
+
+	if pending := scheduler.PendingSequenceIDs(); len(pending) != 0 {
+		t.Errorf("Expected no packets in flight while paused, got %v", pending)
+	}
+
+	scheduler.Resume()
+
+	for i := 0; i < 2; i++ {
+		packet := client.receive()
+
+		if packet.deciphered[0] != byte(i) {
+			t.Errorf("Expected packet %d to be sent after resuming, got packet %d", i, packet.deciphered[0])
+		}
+	}
+
+	if pending := scheduler.PendingSequenceIDs(); len(pending) != 2 {
+		t.Errorf("Expected 2 packets in flight after resuming, got %v", pending)
+	}
+}
@@ -4,7 +4,9 @@ import "errors"
 
 // RMCRequest represets a RMC request
 type RMCRequest struct {
+	isRequest  bool
 	protocolID uint8
+	customID   uint16
 	callID     uint32
 	methodID   uint32
 	parameters []byte
@@ -15,6 +17,27 @@ func (request *RMCRequest) ProtocolID() uint8 {
 	return request.protocolID
 }
 
+// IsRequest returns whether the message had the request bit set in its protocol ID. RMC responses sent by the client,
+// such as replies to notifications, don't, and have protocol IDs of 0x80 and above
+func (request *RMCRequest) IsRequest() bool {
+	return request.isRequest
+}
+
+// CustomID returns the RMC request custom protocol ID, used when the protocol ID is 0x7F
+func (request *RMCRequest) CustomID() uint16 {
+	return request.customID
+}
+
+// FullProtocolID returns the protocol ID the request was sent to. This is the custom protocol ID for
+// protocols which don't fit in 7 bits (protocol ID 0x7F), and the protocol ID otherwise
+func (request *RMCRequest) FullProtocolID() uint16 {
+	if request.protocolID == 0x7F {
+		return request.customID
+	}
+
+	return uint16(request.protocolID)
+}
+
 // CallID sets the RMC request callID
 func (request *RMCRequest) CallID() uint32 {
 	return request.callID
@@ -44,13 +67,27 @@ func NewRMCRequest(data []byte) (RMCRequest, error) {
 		return RMCRequest{}, errors.New("[RMC] Data size does not match")
 	}
 
-	protocolID := stream.ReadUInt8() ^ 0x80
+	protocolByte := stream.ReadUInt8()
+	protocolID := protocolByte ^ 0x80
+	var customID uint16
+
+	// Protocol IDs which don't fit in 7 bits are sent as 0x7F followed by the real ID
+	if protocolID == 0x7F {
+		if len(data) < 15 {
+			return RMCRequest{}, errors.New("[RMC] Data size less than minimum")
+		}
+
+		customID = stream.ReadUInt16LE()
+	}
+
 	callID := stream.ReadUInt32LE()
 	methodID := stream.ReadUInt32LE()
-	parameters := data[13:]
+	parameters := data[stream.ByteOffset():]
 
 	request := RMCRequest{
+		isRequest:  protocolByte&0x80 != 0,
 		protocolID: protocolID,
+		customID:   customID,
 		callID:     callID,
 		methodID:   methodID,
 		parameters: parameters,
@@ -62,6 +99,7 @@ func NewRMCRequest(data []byte) (RMCRequest, error) {
 // RMCResponse represents a RMC response
 type RMCResponse struct {
 	protocolID uint8
+	customID   uint16
 	success    uint8
 	callID     uint32
 	methodID   uint32
@@ -69,6 +107,11 @@ type RMCResponse struct {
 	errorCode  uint32
 }
 
+// SetCustomID sets the RMCResponse custom protocol ID, which is written after the protocol ID when it is 0x7F
+func (response *RMCResponse) SetCustomID(customID uint16) {
+	response.customID = customID
+}
+
 // SetSuccess sets the RMCResponse payload to an instance of RMCSuccess
 func (response *RMCResponse) SetSuccess(methodID uint32, data []byte) {
 	response.success = 1
@@ -87,6 +130,11 @@ func (response *RMCResponse) Bytes() []byte {
 	body := NewStreamOut(nil)
 
 	body.WriteUInt8(response.protocolID)
+
+	if response.protocolID == 0x7F {
+		body.WriteUInt16LE(response.customID)
+	}
+
 	body.WriteUInt8(response.success)
 
 	if response.success == 1 {
@@ -118,3 +166,12 @@ func NewRMCResponse(protocolID uint8, callID uint32) RMCResponse {
 
 	return response
 }
+
+// NewRMCErrorResponse returns a new RMCResponse holding an RMCError with the given error code, such as a QError.
+// For protocol IDs above 0x7E, pass 0x7F and set the real ID with SetCustomID
+func NewRMCErrorResponse(protocolID uint8, callID uint32, errorCode uint32) RMCResponse {
+	response := NewRMCResponse(protocolID, callID)
+	response.SetError(errorCode)
+
+	return response
+}
@@ -0,0 +1,58 @@
+package nex
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRMCExtendedProtocolRoundTrip(t *testing.T) {
+	parameters := []byte{0x01, 0x02, 0x03}
+
+	request, err := NewRMCRequest(newTestRMCRequest(0x0123, 9, 4, parameters))
+
+	if err != nil {
+		t.Fatalf("NewRMCRequest failed: %v", err)
+	}
+
+	if request.ProtocolID() != 0x7F || request.CustomID() != 0x0123 || request.FullProtocolID() != 0x0123 {
+		t.Errorf("Expected extended protocol 0x0123, got protocol %X custom %X", request.ProtocolID(), request.CustomID())
+	}
+
+	// The response mirrors the request encoding of the protocol ID, without the request bit
+	response := NewRMCResponse(request.ProtocolID(), request.CallID())
+	response.SetCustomID(request.CustomID())
+	response.SetSuccess(request.MethodID(), []byte{0xAA, 0xBB})
+
+	stream := NewStreamIn(response.Bytes(), nil)
+	body, err := stream.ReadBuffer()
+
+	if err != nil {
+		t.Fatalf("Failed to read the response body: %v", err)
+	}
+
+	bodyStream := NewStreamIn(body, nil)
+
+	protocolID := bodyStream.ReadUInt8()
+	customID := bodyStream.ReadUInt16LE()
+	success := bodyStream.ReadUInt8()
+	callID := bodyStream.ReadUInt32LE()
+	methodID := bodyStream.ReadUInt32LE()
+	data := body[bodyStream.ByteOffset():]
+
+	if protocolID != 0x7F || customID != 0x0123 {
+		t.Errorf("Expected extended protocol 0x0123, got protocol %X custom %X", protocolID, customID)
+	}
+
+	if success != 1 || callID != 9 || methodID != 4|0x8000 || !bytes.Equal(data, []byte{0xAA, 0xBB}) {
+		t.Errorf("Unexpected response: success %d call %d method %X data % X", success, callID, methodID, data)
+	}
+
+	errorResponse := NewRMCErrorResponse(0x7F, 10, uint32(QErrorCoreNotImplemented))
+	errorResponse.SetCustomID(0x0123)
+
+	errorBody, err := NewStreamIn(errorResponse.Bytes(), nil).ReadBuffer()
+
+	if err != nil || !bytes.Equal(errorBody[:3], []byte{0x7F, 0x23, 0x01}) || len(errorBody) != 12 {
+		t.Errorf("Unexpected extended protocol error response % X (error %v)", errorBody, err)
+	}
+}
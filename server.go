@@ -1,206 +1,1076 @@
 package nex
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"math"
 	"math/rand"
 	"net"
 	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Server represents a PRUDP server
 type Server struct {
 	socket                *net.UDPConn
 	compressPacket        func([]byte) []byte
-	decompressPacket      func([]byte) []byte
+	decompressPacket      func([]byte) ([]byte, error)
 	clients               map[string]*Client
+	clientsByPID          map[uint64]*Client
+	clientsByConnectionID map[uint32]*Client
+	connectionIDCounter   *Counter
+	clientsMutex          sync.RWMutex
+	clientDiscriminator   func(*net.UDPAddr, []byte) string
+	migrationHandles      []func(*Client, *net.UDPAddr, *net.UDPAddr)
+	connectionSignature   func(*Client) []byte
+	payloadTransformIn    func([]byte) ([]byte, error)
+	payloadTransformOut   func([]byte) ([]byte, error)
+	datagramTransformIn   func([]byte) ([]byte, error)
+	datagramTransformOut  func([]byte) ([]byte, error)
+	packetRateLimiter     *RateLimiter
+	migrationRateLimiter  *RateLimiter
+	globalRateLimiter     *RateLimiter
+	clock                 func() time.Time
 	genericEventHandles   map[string][]func(PacketInterface)
 	prudpV0EventHandles   map[string][]func(*PacketV0)
 	prudpV1EventHandles   map[string][]func(*PacketV1)
+	packetEventHandles    map[string][]func(*PacketEvent)
+	sequenceGapHandles    []func(*Client, uint16, uint16)
+	payloadHandles        []func(*Client, []byte)
+	packetDroppedHandles  []func(*net.UDPAddr, string)
+	clientTimeoutHandles  []func(*Client)
+	reconnectHandles      []func(*Client)
+	reconnectionWindow    time.Duration
+	recentPIDs            map[uint64]recentPID
+	packetMonitor         func(PacketInterface, bool)
+	rmcEventHandles       map[uint16][]func(PacketInterface)
+	unhandledRMCHandles   []func(PacketInterface)
+	autoRespondUnhandled  bool
+	unhandledRMCErrorCode uint32
 	accessKey             string
 	prudpVersion          int
 	nexVersion            int
 	fragmentSize          int16
 	resendTimeout         float32
+	resendJitter          float32
+	resendMaxIterations   int
+	reliableWindowSize    int
 	usePacketCompression  bool
-	pingTimeout           int
+	compressionPrefix     bool
+	isSecureServer        bool
+	strictDatagramParsing bool
+	pingTimeout           time.Duration
 	signatureVersion      int
 	flagsVersion          int
 	checksumVersion       int
 	kerberosKeySize       int
 	kerberosKeyDerivation int
 	serverVersion         int
+	socketReadBufferSize  int
+	socketWriteBufferSize int
+	readBufferSize        int
+	readBufferPool        *sync.Pool
+	listenWaitGroup       sync.WaitGroup
+	shutdownMutex         sync.Mutex
+	shuttingDown          bool
 }
 
-// Listen starts a NEX server on a given address
-func (server *Server) Listen(address string) {
+// Listen starts a NEX server on a given address. It blocks until the server is shut down, returning any bind or socket error
+func (server *Server) Listen(address string) error {
+	return server.listen(address, nil)
+}
+
+// MustListen is like Listen but panics on error
+func (server *Server) MustListen(address string) {
+	err := server.Listen(address)
+
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ListenAsync starts a NEX server on a given address without blocking.
+// The ready channel is closed once the socket is bound, and any bind or socket error is sent on the error channel instead of panicking
+func (server *Server) ListenAsync(address string) (<-chan struct{}, <-chan error) {
+	ready := make(chan struct{})
+	errc := make(chan error, 1)
+
+	go func() {
+		err := server.listen(address, ready)
+
+		if err != nil {
+			errc <- err
+		}
+
+		close(errc)
+	}()
 
+	return ready, errc
+}
+
+func (server *Server) listen(address string, ready chan<- struct{}) error {
 	protocol := "udp"
 
 	udpAddress, err := net.ResolveUDPAddr(protocol, address)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	socket, err := net.ListenUDP(protocol, udpAddress)
 
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	if server.socketReadBufferSize > 0 {
+		err = socket.SetReadBuffer(server.socketReadBufferSize)
+
+		if err != nil {
+			socket.Close()
+			return err
+		}
+	}
+
+	if server.socketWriteBufferSize > 0 {
+		err = socket.SetWriteBuffer(server.socketWriteBufferSize)
+
+		if err != nil {
+			socket.Close()
+			return err
+		}
 	}
 
+	// The server may be listening again after being shut down
+	server.shutdownMutex.Lock()
+	server.shuttingDown = false
+	server.shutdownMutex.Unlock()
+
 	server.SetSocket(socket)
 
-	quit := make(chan struct{})
+	errc := make(chan error, runtime.NumCPU())
+
+	server.listenWaitGroup.Add(runtime.NumCPU())
 
 	for i := 0; i < runtime.NumCPU(); i++ {
-		go server.listenDatagram(quit)
+		go server.listenDatagram(errc)
 	}
 
 	fmt.Println("NEX server listening on address", udpAddress)
 
 	server.Emit("Listening", nil)
 
-	<-quit
+	if ready != nil {
+		close(ready)
+	}
+
+	err = <-errc
+
+	if err != nil {
+		// The other datagram goroutines keep reading until the socket is closed
+		socket.Close()
+		server.listenWaitGroup.Wait()
+	}
+
+	return err
 }
 
-func (server *Server) listenDatagram(quit chan struct{}) {
+func (server *Server) listenDatagram(errc chan<- error) {
+	defer server.listenWaitGroup.Done()
+
 	err := error(nil)
 
 	for err == nil {
 		err = server.handleSocketMessage()
 	}
 
-	quit <- struct{}{}
+	// Reading from the socket fails once it is closed by Shutdown, which is not an error
+	if server.isShuttingDown() {
+		err = nil
+	}
+
+	errc <- err
+}
+
+// Shutdown closes the server socket and stops resending packets to every client.
+// It returns once every datagram goroutine has exited, at which point Listen returns. An error is returned if the server is
+// not listening. The server can be started again with Listen afterwards
+func (server *Server) Shutdown() error {
+	server.shutdownMutex.Lock()
+
+	if server.shuttingDown {
+		server.shutdownMutex.Unlock()
+		return errors.New("[Server] Server is already shutting down")
+	}
+
+	socket := server.Socket()
+
+	// Setting the flag without a socket to close would make the next Listen treat its first read error as a shutdown
+	if socket == nil {
+		server.shutdownMutex.Unlock()
+		return errors.New("[Server] Server is not listening")
+	}
+
+	server.shuttingDown = true
+	server.shutdownMutex.Unlock()
+
+	err := socket.Close()
+
+	server.listenWaitGroup.Wait()
+
+	server.clientsMutex.RLock()
+	defer server.clientsMutex.RUnlock()
+
+	for _, client := range server.clients {
+		client.ResendScheduler().Stop()
+		client.stopPingTimer()
+	}
+
+	return err
+}
+
+func (server *Server) isShuttingDown() bool {
+	server.shutdownMutex.Lock()
+	defer server.shutdownMutex.Unlock()
 
-	panic(err)
+	return server.shuttingDown
 }
 
 func (server *Server) handleSocketMessage() error {
-	var buffer [64000]byte
+	readBufferPool := server.readBufferPool
+	buffer := readBufferPool.Get().(*[]byte)
 
 	socket := server.Socket()
 
-	length, addr, err := socket.ReadFromUDP(buffer[0:])
+	length, addr, err := socket.ReadFromUDP(*buffer)
 
 	if err != nil {
+		readBufferPool.Put(buffer)
 		return err
 	}
 
-	discriminator := addr.String()
+	// Packets keep referencing their data after this returns, so it is copied out of the pooled buffer
+	data := make([]byte, length)
+	copy(data, (*buffer)[:length])
+
+	readBufferPool.Put(buffer)
+
+	if server.globalRateLimiter != nil && !server.globalRateLimiter.Allow("") {
+		server.emitPacketDropped(addr, "Global packet rate limit exceeded")
+		return nil
+	}
+
+	if server.packetRateLimiter != nil && !server.packetRateLimiter.Allow(addr.IP.String()) {
+		server.emitPacketDropped(addr, "Address packet rate limit exceeded")
+		return nil
+	}
+
+	if server.datagramTransformIn != nil {
+		data, err = server.datagramTransformIn(data)
+
+		if err != nil {
+			server.emitPacketDropped(addr, err.Error())
+			return nil
+		}
+	}
+
+	discriminator := server.clientDiscriminator(addr, data)
+
+	server.clientsMutex.RLock()
+	client, ok := server.clients[discriminator]
+	server.clientsMutex.RUnlock()
+
+	if !ok {
+		client = server.addClient(addr, discriminator, data)
+	}
+
+	client.setAddress(addr)
+
+	var packet PacketInterface
+
+	if server.PrudpVersion() == 0 {
+		packet, err = NewPacketV0(client, data)
+	} else {
+		packet, err = NewPacketV1(client, data)
+	}
+
+	if err != nil {
+		fmt.Println(err)
+		server.emitPacketDropped(addr, err.Error())
+		return nil
+	}
+
+	// Every packet after the handshake must carry the session ID the client sent in its CONNECT
+	if packet.Type() != SynPacket && packet.Type() != ConnectPacket && client.hasSessionID && packet.SessionID() != client.SessionID() {
+		server.emitPacketDropped(addr, "Mismatched session ID")
+		return nil
+	}
+
+	if server.packetMonitor != nil {
+		server.packetMonitor(packet, true)
+	}
+
+	client.resetPingTimer()
+
+	if packet.HasFlag(FlagAck) || packet.HasFlag(FlagMultiAck) {
+		server.handleAcknowledgement(packet)
+		return nil
+	}
+
+	// Secure server DATA is encrypted with the session key, which is only known once the client has authenticated
+	if server.IsSecureServer() && packet.Type() == DataPacket && len(client.SessionKey()) == 0 {
+		server.emitPacketDropped(addr, "DATA packet from unauthenticated client")
+		return nil
+	}
+
+	var dataPackets []PacketInterface
+
+	if packet.Type() == DataPacket {
+		dataPackets, err = server.reassembleDataPacket(packet)
+
+		if err != nil {
+			server.emitPacketDropped(addr, err.Error())
+			return nil
+		}
+	} else if packet.HasFlag(FlagReliable) {
+		server.checkSequenceID(packet)
+	}
+
+	// SYN handling does not depend on the server role, but the client must be reset before the SYN is
+	// acknowledged. Otherwise the reset races with the acknowledgement and can wipe out the server
+	// connection signature generated for it
+	if packet.Type() == SynPacket {
+		server.resetClient(client)
+	}
+
+	if packet.Type() == ConnectPacket {
+		client.SetSessionID(packet.SessionID())
+		server.assignConnectionID(client)
+
+		// The CONNECT acknowledgement is signed with the client connection signature, so it is set before acknowledging
+		client.SetClientConnectionSignature(packet.ConnectionSignature())
+	}
+
+	if packet.HasFlag(FlagNeedsAck) {
+		// A CONNECT carrying a payload (the Kerberos ticket sent to secure servers) is acknowledged by the
+		// application along with its response. Authentication servers receive CONNECT with no payload, which
+		// is acknowledged here like any other packet, echoing its sequence ID and handshake options
+		if packet.Type() != ConnectPacket || len(packet.Payload()) == 0 {
+			go server.AcknowledgePacket(packet, nil)
+		}
+	}
+
+	switch packet.Type() {
+	case SynPacket:
+		server.Emit("Syn", packet)
+	case ConnectPacket:
+		// The client resent a CONNECT which was already answered, reuse the response instead of building it again
+		if connectResponse := client.cachedConnectResponse(packet.Payload()); connectResponse != nil {
+			go server.AcknowledgePacket(packet, connectResponse)
+			return nil
+		}
+
+		server.Emit("Connect", packet)
+	case DataPacket:
+		for _, dataPacket := range dataPackets {
+			server.handleDataPacket(dataPacket)
+		}
+	case DisconnectPacket:
+		server.Kick(client)
+		server.Emit("Disconnect", packet)
+	case PingPacket:
+		server.SendPing(client)
+		server.Emit("Ping", packet)
+	}
+
+	server.Emit("Packet", packet)
+
+	return nil
+}
+
+// maxHeldPackets is how far ahead of the expected sequence ID reliable DATA packets are held until the missing ones arrive
+const maxHeldPackets = 128
+
+// reassembleDataPacket returns the DATA packets which complete a payload now that the given packet has been received.
+// Reliable packets are handled in sequence ID order: packets ahead of a gap are held until the missing ones arrive, duplicates
+// are dropped, and fragments are deciphered, decompressed and joined into the payload of the final fragment
+func (server *Server) reassembleDataPacket(packet PacketInterface) ([]PacketInterface, error) {
+	client := packet.Sender()
+
+	client.reliableMutex.Lock()
+	defer client.reliableMutex.Unlock()
+
+	if !packet.HasFlag(FlagReliable) {
+		err := server.decipherDataPacket(packet)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return []PacketInterface{packet}, nil
+	}
+
+	sequenceID := packet.SequenceID()
+	expected := uint16(client.SequenceIDCounterIn().Value() + 1)
+
+	// Compare as a signed difference so the check holds across sequence ID wrap-around
+	difference := int16(sequenceID - expected)
+
+	if difference < 0 {
+		// Duplicate or resent packet
+		return nil, nil
+	}
+
+	if difference > 0 {
+		if difference > maxHeldPackets {
+			return nil, fmt.Errorf("[Server] Reliable packet %d is too far ahead of the expected sequence ID %d", sequenceID, expected)
+		}
+
+		if _, ok := client.heldPackets[sequenceID]; !ok {
+			client.heldPackets[sequenceID] = packet
+
+			for _, handler := range server.sequenceGapHandles {
+				go handler(client, expected, sequenceID)
+			}
+		}
+
+		return nil, nil
+	}
+
+	var completed []PacketInterface
+
+	for {
+		delete(client.heldPackets, packet.SequenceID())
+		client.SequenceIDCounterIn().Reset(uint64(packet.SequenceID()))
+
+		base := basePacket(packet)
+		err := server.decipherDataPacket(packet)
+
+		switch {
+		case err != nil:
+			// The payload can't be completed without this fragment, so the rest of its fragments are dropped too
+			client.fragments = nil
+			client.droppingFragments = packet.FragmentID() != 0
+			server.emitPacketDropped(client.Address(), err.Error())
+		case client.droppingFragments:
+			client.droppingFragments = packet.FragmentID() != 0
+		case packet.FragmentID() != 0:
+			client.fragments = append(client.fragments, base.deciphered...)
+		default:
+			if len(client.fragments) > 0 {
+				base.deciphered = append(client.fragments, base.deciphered...)
+				client.fragments = nil
+			}
+
+			completed = append(completed, packet)
+		}
+
+		next, ok := client.heldPackets[packet.SequenceID()+1]
+
+		if !ok {
+			break
+		}
+
+		packet = next
+	}
+
+	return completed, nil
+}
+
+// decipherDataPacket deciphers and decompresses the payload of a received DATA packet.
+// Fragments are compressed separately by the sender, so each one is decompressed before the payload is joined
+func (server *Server) decipherDataPacket(packet PacketInterface) error {
+	base := basePacket(packet)
+	base.decipherPayload()
+
+	decompressed, err := server.decompressPacket(base.deciphered)
+
+	if err != nil {
+		return fmt.Errorf("[Server] Error decompressing DATA packet %d: %w", packet.SequenceID(), err)
+	}
+
+	base.deciphered = decompressed
+
+	return nil
+}
+
+// handleDataPacket parses the reassembled payload of a DATA packet as an RMC request, and emits the packet
+func (server *Server) handleDataPacket(packet PacketInterface) {
+	if payload := basePacket(packet).deciphered; len(payload) > 0 {
+		request, err := server.parseRMCRequest(packet.Sender(), payload)
+
+		if err != nil {
+			err = fmt.Errorf("[Server] Error parsing RMC request: %w", err)
+			server.emitPacketDropped(packet.Sender().Address(), err.Error())
+			return
+		}
+
+		basePacket(packet).rmcRequest = request
+		basePacket(packet).hasRMCRequest = true
+		server.emitRMC(packet)
+	}
+
+	server.Emit("Data", packet)
+}
+
+// parseRMCRequest parses the RMC request in a deciphered, decompressed and reassembled DATA packet payload sent by the given client
+func (server *Server) parseRMCRequest(client *Client, payload []byte) (RMCRequest, error) {
+	if server.payloadTransformIn != nil {
+		transformed, err := server.payloadTransformIn(payload)
+
+		if err != nil {
+			return RMCRequest{}, err
+		}
+
+		payload = transformed
+	}
+
+	for _, handler := range server.payloadHandles {
+		go handler(client, append([]byte{}, payload...))
+	}
+
+	return NewRMCRequest(payload)
+}
+
+func (server *Server) handleAcknowledgement(packet PacketInterface) {
+	scheduler := packet.Sender().ResendScheduler()
+
+	if !packet.HasFlag(FlagMultiAck) {
+		scheduler.AcknowledgePacket(packet.SequenceID())
+		return
+	}
+
+	// Aggregate acknowledgement
+	stream := NewStreamIn(packet.Payload(), server)
+	baseSequenceID := packet.SequenceID()
+
+	// New version
+	if server.NexVersion() >= 2 {
+		if len(packet.Payload()) < 4 {
+			return
+		}
+
+		_ = stream.ReadUInt8() // substream ID
+		additionalIDsCount := stream.ReadUInt8()
+		baseSequenceID = stream.ReadUInt16LE()
+
+		if len(packet.Payload()) < 4+(int(additionalIDsCount)*2) {
+			return
+		}
+	}
+
+	scheduler.AcknowledgePacketsUpTo(baseSequenceID)
+
+	for stream.ByteOffset()+2 <= stream.ByteCapacity() {
+		scheduler.AcknowledgePacket(stream.ReadUInt16LE())
+	}
+}
+
+// addClient stores a client for a datagram from an unknown discriminator. If the datagram was signed by an authenticated
+// client, that client is moved to the new discriminator instead of creating a new one
+func (server *Server) addClient(addr *net.UDPAddr, discriminator string, data []byte) *Client {
+	// The signature check computes a HMAC for each candidate, so it is done before taking the clients lock
+	migratedClient := server.findMigratedClient(addr, data)
+
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+
+	// Another datagram goroutine may have added the client in the meantime
+	if client, ok := server.clients[discriminator]; ok {
+		return client
+	}
+
+	// The client may have been kicked while its signature was checked
+	if migratedClient != nil && server.clients[migratedClient.discriminator] == migratedClient {
+		// The client is already authenticated, it's just sending from a new address (NAT rebinding)
+		for _, handler := range server.migrationHandles {
+			go handler(migratedClient, migratedClient.Address(), addr)
+		}
+
+		delete(server.clients, migratedClient.discriminator)
+		migratedClient.discriminator = discriminator
+		server.clients[discriminator] = migratedClient
+
+		return migratedClient
+	}
+
+	client := NewClient(addr, server)
+	client.discriminator = discriminator
+	server.clients[discriminator] = client
+
+	return client
+}
+
+func (server *Server) checkSequenceID(packet PacketInterface) {
+	client := packet.Sender()
+
+	client.reliableMutex.Lock()
+	defer client.reliableMutex.Unlock()
+
+	sequenceID := packet.SequenceID()
+	expected := uint16(client.SequenceIDCounterIn().Value() + 1)
+
+	// Compare as a signed difference so the check holds across sequence ID wrap-around
+	difference := int16(sequenceID - expected)
+
+	if difference < 0 {
+		// Duplicate or resent packet
+		return
+	}
+
+	if difference > 0 {
+		for _, handler := range server.sequenceGapHandles {
+			go handler(client, expected, sequenceID)
+		}
+	}
+
+	client.SequenceIDCounterIn().Reset(uint64(sequenceID))
+}
+
+// findMigratedClient finds the authenticated client which signed the given PRUDPv1 datagram, if any.
+// Only reliable DATA packets newer than any the client has sent so far are considered, so a captured packet
+// cannot be replayed from another address to take over the session. Attempts are rate limited per IP address
+func (server *Server) findMigratedClient(addr *net.UDPAddr, data []byte) *Client {
+	// Only PRUDPv1 signatures are tied to the client's keys and connection signature
+	if server.PrudpVersion() != 1 || len(data) < 30 || !bytes.Equal(data[:2], []byte{0xEA, 0xD0}) {
+		return nil
+	}
+
+	optionsLength := int(data[3])
+	payloadSize := int(binary.LittleEndian.Uint16(data[4:6]))
+
+	if len(data) < 30+optionsLength+payloadSize {
+		return nil
+	}
+
+	typeFlags := binary.LittleEndian.Uint16(data[8:10])
+	packetType := typeFlags & 0xF
+	flags := typeFlags >> 4
+
+	if server.FlagsVersion() == 0 {
+		packetType = typeFlags & 7
+		flags = typeFlags >> 3
+	}
+
+	if packetType != DataPacket || flags&FlagReliable == 0 {
+		return nil
+	}
+
+	if !server.migrationRateLimiter.Allow(addr.IP.String()) {
+		return nil
+	}
+
+	sessionID := data[10]
+	sequenceID := binary.LittleEndian.Uint16(data[12:14])
+	header := data[2:14]
+	signature := data[14:30]
+	options := data[30 : 30+optionsLength]
+	payload := data[30+optionsLength : 30+optionsLength+payloadSize]
+
+	for _, client := range server.Clients() {
+		if len(client.SessionKey()) == 0 || client.SessionID() != sessionID {
+			continue
+		}
+
+		// Compare as a signed difference so the check holds across sequence ID wrap-around
+		if int16(sequenceID-uint16(client.SequenceIDCounterIn().Value())) <= 0 {
+			continue
+		}
+
+		packet := PacketV1{Packet: NewPacket(client, nil)}
+		calculatedSignature := packet.calculateSignature(header, client.ServerConnectionSignature(), options, payload)
+
+		if bytes.Equal(calculatedSignature, signature) {
+			return client
+		}
+	}
+
+	return nil
+}
+
+// On sets the data event handler
+func (server *Server) On(event string, handler interface{}) {
+	// Check if the handler type matches one of the allowed types, and store the handler in it's allowed property
+	// Need to cast the handler to the correct function type before storing
+	switch handler.(type) {
+	case func(PacketInterface):
+		server.genericEventHandles[event] = append(server.genericEventHandles[event], handler.(func(PacketInterface)))
+	case func(*PacketV0):
+		server.prudpV0EventHandles[event] = append(server.prudpV0EventHandles[event], handler.(func(*PacketV0)))
+	case func(*PacketV1):
+		server.prudpV1EventHandles[event] = append(server.prudpV1EventHandles[event], handler.(func(*PacketV1)))
+	case func(*PacketEvent):
+		server.packetEventHandles[event] = append(server.packetEventHandles[event], handler.(func(*PacketEvent)))
+	}
+}
+
+// OnSequenceGap sets a handler which is run when a reliable packet arrives with a sequence ID ahead of the expected one,
+// meaning the packets in between were lost or delayed. DATA packets after the gap are held until the missing ones arrive
+func (server *Server) OnSequenceGap(handler func(client *Client, expected uint16, got uint16)) {
+	server.sequenceGapHandles = append(server.sequenceGapHandles, handler)
+}
+
+// OnReliablePayload sets a handler which is run with the decrypted, reassembled and decompressed payload of each DATA packet,
+// before it is parsed as an RMC request. The handler is run even if the payload is not a valid RMC request, but not for
+// packets which are dropped before that, such as duplicates or packets from unauthenticated clients
+func (server *Server) OnReliablePayload(handler func(client *Client, payload []byte)) {
+	server.payloadHandles = append(server.payloadHandles, handler)
+}
+
+// OnClientConnected sets a handler which is run once a client has completed the SYN/CONNECT handshake, after its CONNECT is
+// acknowledged. The handler receives the CONNECT packet. This is the same as handling the "ClientConnected" event with On
+func (server *Server) OnClientConnected(handler func(PacketInterface)) {
+	server.On("ClientConnected", handler)
+}
+
+// OnClientTimeout sets a handler which is run after a client is kicked for not sending any packets within the ping timeout
+func (server *Server) OnClientTimeout(handler func(client *Client)) {
+	server.clientTimeoutHandles = append(server.clientTimeoutHandles, handler)
+}
+
+// OnReconnect sets a handler which is run when a client is assigned the PID of a client which was removed within the reconnection window.
+// The user data of the previous client is restored on the new one before the handler runs
+func (server *Server) OnReconnect(handler func(client *Client)) {
+	server.reconnectHandles = append(server.reconnectHandles, handler)
+}
+
+// timeoutClient kicks a client which stopped responding and runs the timeout handlers
+func (server *Server) timeoutClient(client *Client) {
+	if !server.ClientConnected(client) {
+		return
+	}
+
+	server.Kick(client)
+
+	for _, handler := range server.clientTimeoutHandles {
+		go handler(client)
+	}
+}
+
+// OnRMC sets a handler which is run for every RMC request sent to the given protocol.
+// Protocols which don't fit in 7 bits are registered with their custom protocol ID, see RMCRequest.FullProtocolID
+func (server *Server) OnRMC(protocolID uint16, handler func(PacketInterface)) {
+	server.rmcEventHandles[protocolID] = append(server.rmcEventHandles[protocolID], handler)
+}
+
+// OnUnhandledRMC sets a handler which is run for RMC requests sent to a protocol with no handler set by OnRMC
+func (server *Server) OnUnhandledRMC(handler func(PacketInterface)) {
+	server.unhandledRMCHandles = append(server.unhandledRMCHandles, handler)
+}
+
+func (server *Server) emitRMC(packet PacketInterface) {
+	request := packet.RMCRequest()
+	handlers, ok := server.rmcEventHandles[request.FullProtocolID()]
+
+	if !ok {
+		handlers = server.unhandledRMCHandles
+
+		// Only requests are answered, answering an RMC response from the client with an error would make no sense
+		if len(handlers) == 0 && server.autoRespondUnhandled && request.IsRequest() {
+			server.respondUnhandledRMC(packet)
+			return
+		}
+	}
+
+	for _, handler := range handlers {
+		go handler(packet)
+	}
+}
+
+func (server *Server) respondUnhandledRMC(packet PacketInterface) {
+	request := packet.RMCRequest()
+
+	response := NewRMCErrorResponse(request.ProtocolID(), request.CallID(), server.unhandledRMCErrorCode)
+	response.SetCustomID(request.CustomID())
+
+	var responsePacket PacketInterface
+
+	if server.PrudpVersion() == 0 {
+		responsePacket, _ = NewPacketV0(packet.Sender(), nil)
+	} else {
+		responsePacket, _ = NewPacketV1(packet.Sender(), nil)
+	}
+
+	responsePacket.SetSource(packet.Destination())
+	responsePacket.SetDestination(packet.Source())
+	responsePacket.SetType(DataPacket)
+	responsePacket.SetPayload(response.Bytes())
+	responsePacket.AddFlag(FlagNeedsAck)
+	responsePacket.AddFlag(FlagReliable)
+
+	server.Send(responsePacket)
+}
+
+// OnPacketDropped sets a handler which is run when a datagram is dropped without being processed, along with the reason
+func (server *Server) OnPacketDropped(handler func(address *net.UDPAddr, reason string)) {
+	server.packetDroppedHandles = append(server.packetDroppedHandles, handler)
+}
+
+func (server *Server) emitPacketDropped(address *net.UDPAddr, reason string) {
+	for _, handler := range server.packetDroppedHandles {
+		go handler(address, reason)
+	}
+}
+
+// Emit runs the given event handle
+func (server *Server) Emit(event string, packet interface{}) {
+
+	eventName := server.genericEventHandles[event]
+	for i := 0; i < len(eventName); i++ {
+		handler := eventName[i]
+		packet := packet.(PacketInterface)
+		go handler(packet)
+	}
+
+	if packet, ok := packet.(PacketInterface); ok {
+		eventName := server.packetEventHandles[event]
+		for i := 0; i < len(eventName); i++ {
+			handler := eventName[i]
+			go handler(NewPacketEvent(packet))
+		}
+	}
+
+	// Check if the packet type matches one of the allowed types and run the given handler
+
+	switch packet.(type) {
+	case *PacketV0:
+		eventName := server.prudpV0EventHandles[event]
+		for i := 0; i < len(eventName); i++ {
+			handler := eventName[i]
+			go handler(packet.(*PacketV0))
+		}
+	case *PacketV1:
+		eventName := server.prudpV1EventHandles[event]
+		for i := 0; i < len(eventName); i++ {
+			handler := eventName[i]
+			go handler(packet.(*PacketV1))
+		}
+	}
+}
+
+// OnClientMigrated sets a handler which is run when an authenticated client is moved to a new address after sending a signed
+// packet from it, such as after a NAT rebinding. The handler receives the client along with its old and new addresses
+func (server *Server) OnClientMigrated(handler func(client *Client, oldAddress *net.UDPAddr, newAddress *net.UDPAddr)) {
+	server.migrationHandles = append(server.migrationHandles, handler)
+}
+
+// ClientConnected checks if a given client is stored on the server
+func (server *Server) ClientConnected(client *Client) bool {
+	server.clientsMutex.RLock()
+	defer server.clientsMutex.RUnlock()
+
+	discriminator := client.Discriminator()
+
+	connectedClient, connected := server.clients[discriminator]
+
+	return connected && connectedClient == client
+}
+
+// Clients returns a snapshot of the clients currently stored on the server
+func (server *Server) Clients() []*Client {
+	server.clientsMutex.RLock()
+	defer server.clientsMutex.RUnlock()
+
+	clients := make([]*Client, 0, len(server.clients))
+
+	for _, client := range server.clients {
+		clients = append(clients, client)
+	}
+
+	return clients
+}
+
+// Broadcast sends the packet to every connected client. A new packet is built for each client so it
+// is fragmented, numbered and signed using that client's own sequence IDs and keys. The packet's sender is ignored.
+// Clients which have not completed the SYN/CONNECT handshake are skipped, as they have no session to send to yet.
+// If sending to a client fails the packet is still sent to the rest, and the first error is returned
+func (server *Server) Broadcast(packet PacketInterface) error {
+	var broadcastErr error
+
+	for _, client := range server.Clients() {
+		if atomic.LoadInt32(&client.connected) == 0 {
+			continue
+		}
+
+		var clientPacket PacketInterface
+
+		if server.PrudpVersion() == 0 {
+			clientPacket, _ = NewPacketV0(client, nil)
+		} else {
+			clientPacket, _ = NewPacketV1(client, nil)
+		}
+
+		clientPacket.SetVersion(packet.Version())
+		clientPacket.SetSource(packet.Source())
+		clientPacket.SetDestination(packet.Destination())
+		clientPacket.SetType(packet.Type())
+		clientPacket.SetFlags(packet.Flags())
+		clientPacket.SetPayload(append([]byte{}, packet.Payload()...))
+
+		err := server.Send(clientPacket)
+
+		if err != nil && broadcastErr == nil {
+			broadcastErr = err
+		}
+	}
+
+	return broadcastErr
+}
+
+// ClientByPID returns the connected client which was assigned the given PID with Client.SetPID.
+// PIDs are matched by value, regardless of whether they are 32-bit or 64-bit
+func (server *Server) ClientByPID(pid *PID) (*Client, bool) {
+	if pid == nil {
+		return nil, false
+	}
+
+	server.clientsMutex.RLock()
+	defer server.clientsMutex.RUnlock()
+
+	client, ok := server.clientsByPID[pid.Value()]
+
+	return client, ok
+}
+
+// setClientPID updates the PID index when a client is assigned a PID
+func (server *Server) setClientPID(client *Client, pid *PID) {
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+
+	if oldPID := client.pidValue(); oldPID != 0 && server.clientsByPID[oldPID] == client {
+		delete(server.clientsByPID, oldPID)
+	}
 
-	if _, ok := server.clients[discriminator]; !ok {
-		newClient := NewClient(addr, server)
-		server.clients[discriminator] = newClient
+	if pid == nil || pid.Value() == 0 {
+		client.pid.Store((*PID)(nil))
+		return
 	}
 
-	client := server.clients[discriminator]
+	client.pid.Store(pid.Copy())
+	server.clientsByPID[pid.Value()] = client
+	server.restoreRecentPID(client, pid.Value())
+}
 
-	data := buffer[0:length]
+// recentPID holds the state of a client which was removed from the server, so it can be restored if the user reconnects
+type recentPID struct {
+	userData  interface{}
+	expiresAt time.Time
+}
 
-	var packet PacketInterface
+// rememberPID stores the state of a client being removed so it can be restored by restoreRecentPID. The clients lock must be held
+func (server *Server) rememberPID(client *Client) {
+	pid := client.pidValue()
 
-	if server.PrudpVersion() == 0 {
-		packet, err = NewPacketV0(client, data)
-	} else {
-		packet, err = NewPacketV1(client, data)
+	if server.reconnectionWindow <= 0 || pid == 0 {
+		return
 	}
 
-	if err != nil {
-		fmt.Println(err)
-		return nil
+	now := server.Now()
+
+	for recentPIDValue, recent := range server.recentPIDs {
+		if !now.Before(recent.expiresAt) {
+			delete(server.recentPIDs, recentPIDValue)
+		}
 	}
 
-	if packet.HasFlag(FlagAck) || packet.HasFlag(FlagMultiAck) {
-		return nil
+	server.recentPIDs[pid] = recentPID{
+		userData:  client.UserData(),
+		expiresAt: now.Add(server.reconnectionWindow),
 	}
+}
 
-	if packet.HasFlag(FlagNeedsAck) {
-		if packet.Type() != ConnectPacket || (packet.Type() == ConnectPacket && len(packet.Payload()) <= 0) {
-			go server.AcknowledgePacket(packet, nil)
-		}
+// restoreRecentPID restores the state of a client removed within the reconnection window with the same PID,
+// and runs the reconnect handlers. The clients lock must be held
+func (server *Server) restoreRecentPID(client *Client, pid uint64) {
+	recent, ok := server.recentPIDs[pid]
+
+	if !ok {
+		return
 	}
 
-	switch packet.Type() {
-	case SynPacket:
-		client.Reset()
-		server.Emit("Syn", packet)
-	case ConnectPacket:
-		packet.Sender().SetClientConnectionSignature(packet.ConnectionSignature())
+	delete(server.recentPIDs, pid)
 
-		server.Emit("Connect", packet)
-	case DataPacket:
-		server.Emit("Data", packet)
-	case DisconnectPacket:
-		server.Kick(client)
-		server.Emit("Disconnect", packet)
-	case PingPacket:
-		server.SendPing(client)
-		server.Emit("Ping", packet)
+	if !server.Now().Before(recent.expiresAt) {
+		return
 	}
 
-	server.Emit("Packet", packet)
+	client.SetUserData(recent.userData)
 
-	return nil
+	for _, handler := range server.reconnectHandles {
+		go handler(client)
+	}
 }
 
-// On sets the data event handler
-func (server *Server) On(event string, handler interface{}) {
-	// Check if the handler type matches one of the allowed types, and store the handler in it's allowed property
-	// Need to cast the handler to the correct function type before storing
-	switch handler.(type) {
-	case func(PacketInterface):
-		server.genericEventHandles[event] = append(server.genericEventHandles[event], handler.(func(PacketInterface)))
-	case func(*PacketV0):
-		server.prudpV0EventHandles[event] = append(server.prudpV0EventHandles[event], handler.(func(*PacketV0)))
-	case func(*PacketV1):
-		server.prudpV1EventHandles[event] = append(server.prudpV1EventHandles[event], handler.(func(*PacketV1)))
-	}
+// ClientByConnectionID returns the connected client which was assigned the given connection ID
+func (server *Server) ClientByConnectionID(connectionID uint32) (*Client, bool) {
+	server.clientsMutex.RLock()
+	defer server.clientsMutex.RUnlock()
+
+	client, ok := server.clientsByConnectionID[connectionID]
+
+	return client, ok
 }
 
-// Emit runs the given event handle
-func (server *Server) Emit(event string, packet interface{}) {
+// assignConnectionID gives the client a new connection ID when it sends its first CONNECT
+func (server *Server) assignConnectionID(client *Client) {
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
 
-	eventName := server.genericEventHandles[event]
-	for i := 0; i < len(eventName); i++ {
-		handler := eventName[i]
-		packet := packet.(PacketInterface)
-		go handler(packet)
+	if client.ConnectionID() != 0 {
+		// Resent CONNECT
+		return
 	}
 
-	// Check if the packet type matches one of the allowed types and run the given handler
+	connectionID := uint32(server.connectionIDCounter.Increment())
+	atomic.StoreUint32(&client.connectionID, connectionID)
+	server.clientsByConnectionID[connectionID] = client
+}
 
-	switch packet.(type) {
-	case *PacketV0:
-		eventName := server.prudpV0EventHandles[event]
-		for i := 0; i < len(eventName); i++ {
-			handler := eventName[i]
-			go handler(packet.(*PacketV0))
-		}
-	case *PacketV1:
-		eventName := server.prudpV1EventHandles[event]
-		for i := 0; i < len(eventName); i++ {
-			handler := eventName[i]
-			go handler(packet.(*PacketV1))
-		}
-	}
+// resetClient removes the client from the PID and connection ID indexes and resets it for a new handshake
+func (server *Server) resetClient(client *Client) {
+	server.clientsMutex.Lock()
+	server.unindexClient(client)
+	server.clientsMutex.Unlock()
+
+	client.Reset()
 }
 
-// ClientConnected checks if a given client is stored on the server
-func (server *Server) ClientConnected(client *Client) bool {
-	discriminator := client.Address().String()
+// unindexClient removes the client from the PID and connection ID indexes, remembering its PID for the reconnection window.
+// The clients lock must be held
+func (server *Server) unindexClient(client *Client) {
+	server.rememberPID(client)
+
+	if pid := client.pidValue(); pid != 0 && server.clientsByPID[pid] == client {
+		delete(server.clientsByPID, pid)
+	}
 
-	_, connected := server.clients[discriminator]
+	if connectionID := client.ConnectionID(); connectionID != 0 && server.clientsByConnectionID[connectionID] == client {
+		delete(server.clientsByConnectionID, connectionID)
+	}
 
-	return connected
+	client.pid.Store((*PID)(nil))
+	atomic.StoreUint32(&client.connectionID, 0)
 }
 
 // Kick removes a client from the server
 func (server *Server) Kick(client *Client) {
-	discriminator := client.Address().String()
+	server.clientsMutex.Lock()
+	defer server.clientsMutex.Unlock()
+
+	discriminator := client.Discriminator()
 
 	if _, ok := server.clients[discriminator]; ok {
+		client.ResendScheduler().Stop()
+		client.stopPingTimer()
+		server.unindexClient(client)
+		client.SetUserData(nil)
 		delete(server.clients, discriminator)
-		fmt.Println("Kicked user", discriminator)
+		fmt.Println("Kicked user", client)
 	}
 }
 
@@ -238,12 +1108,21 @@ func (server *Server) AcknowledgePacket(packet PacketInterface, payload []byte)
 	ackPacket.SetSource(packet.Destination())
 	ackPacket.SetDestination(packet.Source())
 	ackPacket.SetType(packet.Type())
+	ackPacket.SetSessionID(packet.SessionID())
 	ackPacket.SetSequenceID(packet.SequenceID())
 	ackPacket.SetFragmentID(packet.FragmentID())
 	ackPacket.AddFlag(FlagAck)
 
+	if packet.Type() == SynPacket {
+		sender.SetServerConnectionSignature(server.connectionSignature(sender))
+	}
+
 	if payload != nil {
 		ackPacket.SetPayload(payload)
+
+		if packet.Type() == ConnectPacket {
+			sender.setConnectResponse(packet.Payload(), payload)
+		}
 	}
 
 	if server.PrudpVersion() == 1 {
@@ -255,15 +1134,10 @@ func (server *Server) AcknowledgePacket(packet PacketInterface, payload []byte)
 		ackPacket.AddFlag(FlagHasSize)
 
 		if packet.Type() == SynPacket {
-			serverConnectionSignature := make([]byte, 16)
-			rand.Read(serverConnectionSignature)
-
-			ackPacket.Sender().SetServerConnectionSignature(serverConnectionSignature)
-
 			ackPacket.SetSupportedFunctions(packet.SupportedFunctions())
 			ackPacket.SetMaximumSubstreamID(0)
 
-			ackPacket.SetConnectionSignature(serverConnectionSignature)
+			ackPacket.SetConnectionSignature(sender.ServerConnectionSignature())
 		}
 
 		if packet.Type() == ConnectPacket {
@@ -301,7 +1175,16 @@ func (server *Server) AcknowledgePacket(packet PacketInterface, payload []byte)
 
 	data := ackPacket.Bytes()
 
+	if server.packetMonitor != nil {
+		server.packetMonitor(ackPacket, false)
+	}
+
 	server.SendRaw(sender.Address(), data)
+
+	// Only the first acknowledgement completes the handshake, resent CONNECTs are acknowledged again
+	if packet.Type() == ConnectPacket && atomic.CompareAndSwapInt32(&sender.connected, 0, 1) {
+		server.Emit("ClientConnected", packet)
+	}
 }
 
 // Socket returns the underlying server UDP socket
@@ -314,6 +1197,64 @@ func (server *Server) SetSocket(socket *net.UDPConn) {
 	server.socket = socket
 }
 
+// ReadBufferSize returns the size in bytes of the buffers datagrams are read into
+func (server *Server) ReadBufferSize() int {
+	return server.readBufferSize
+}
+
+// SetReadBufferSize sets the size in bytes of the buffers datagrams are read into. Datagrams larger than this are truncated.
+// The buffers are reused between reads. Must be called before Listen
+// An error is returned if the size is not positive, as a buffer with no room would drop every datagram
+func (server *Server) SetReadBufferSize(size int) error {
+	if size < 1 {
+		return fmt.Errorf("[Server] Read buffer size %d must be positive", size)
+	}
+
+	server.readBufferSize = size
+	server.readBufferPool = &sync.Pool{
+		New: func() interface{} {
+			buffer := make([]byte, size)
+			return &buffer
+		},
+	}
+
+	return nil
+}
+
+// SetReadKernelBuffer sets the size in bytes of the operating system receive buffer for the UDP socket.
+// Must be called before Listen. A size of 0 keeps the system default
+func (server *Server) SetReadKernelBuffer(size int) {
+	server.socketReadBufferSize = size
+}
+
+// SetWriteKernelBuffer sets the size in bytes of the operating system transmit buffer for the UDP socket.
+// Must be called before Listen. A size of 0 keeps the system default
+func (server *Server) SetWriteKernelBuffer(size int) {
+	server.socketWriteBufferSize = size
+}
+
+// StrictDatagramParsing returns whether datagrams with data left over after the packet are dropped
+func (server *Server) StrictDatagramParsing() bool {
+	return server.strictDatagramParsing
+}
+
+// SetStrictDatagramParsing sets whether datagrams with data left over after the packet are dropped. When disabled,
+// which is the default, the leftover data is ignored. Dropped datagrams are reported to the OnPacketDropped handlers
+func (server *Server) SetStrictDatagramParsing(strictDatagramParsing bool) {
+	server.strictDatagramParsing = strictDatagramParsing
+}
+
+// IsSecureServer returns whether the server is a secure server, which requires clients to authenticate with a Kerberos ticket on CONNECT
+func (server *Server) IsSecureServer() bool {
+	return server.isSecureServer
+}
+
+// SetIsSecureServer sets whether the server is a secure server, which requires clients to authenticate with a Kerberos ticket on CONNECT.
+// On secure servers, DATA packets from clients which have no session key set are dropped
+func (server *Server) SetIsSecureServer(isSecureServer bool) {
+	server.isSecureServer = isSecureServer
+}
+
 // PrudpVersion returns the server PRUDP version
 func (server *Server) PrudpVersion() int {
 	return server.prudpVersion
@@ -359,11 +1300,47 @@ func (server *Server) AccessKey() string {
 	return server.accessKey
 }
 
-// SetAccessKey sets the server access key
+// SetAccessKey sets the server access key. The key is not validated, see ValidateAccessKey.
+// Connected clients keep the signature key derived from the old access key, so their packets will fail validation.
+// Use RotateAccessKey to change the key while the server is running
 func (server *Server) SetAccessKey(accessKey string) {
 	server.accessKey = accessKey
 }
 
+// RotateAccessKey sets the server access key and kicks every connected client, as their
+// signatures were derived from the old key. Clients have to reconnect using the new key
+func (server *Server) RotateAccessKey(accessKey string) {
+	server.SetAccessKey(accessKey)
+
+	for _, client := range server.Clients() {
+		server.Kick(client)
+	}
+}
+
+// PingTimeout returns how long a client may go without sending a packet before it is pinged.
+// A client which still sends nothing for the same amount of time after the ping is kicked
+func (server *Server) PingTimeout() time.Duration {
+	return server.pingTimeout
+}
+
+// SetPingTimeout sets how long a client may go without sending a packet before it is pinged.
+// A client which still sends nothing for the same amount of time after the ping is kicked. 0 disables the timeout
+func (server *Server) SetPingTimeout(pingTimeout time.Duration) {
+	server.pingTimeout = pingTimeout
+}
+
+// ReconnectionWindow returns how long the state of a removed client is kept for a reconnecting client with the same PID
+func (server *Server) ReconnectionWindow() time.Duration {
+	return server.reconnectionWindow
+}
+
+// SetReconnectionWindow sets how long the state of a removed client is kept for a reconnecting client with the same PID.
+// Clients are removed when kicked or when they start a new handshake. If a client is assigned the same PID with Client.SetPID
+// within the window, its user data is restored and the OnReconnect handlers are run. 0 disables reconnection handling
+func (server *Server) SetReconnectionWindow(reconnectionWindow time.Duration) {
+	server.reconnectionWindow = reconnectionWindow
+}
+
 // SignatureVersion returns the server packet signature version
 func (server *Server) SignatureVersion() int {
 	return server.signatureVersion
@@ -384,59 +1361,384 @@ func (server *Server) SetKerberosKeySize(kerberosKeySize int) {
 	server.kerberosKeySize = kerberosKeySize
 }
 
+// FragmentSize returns the default maximum payload size of each packet fragment
+func (server *Server) FragmentSize() int16 {
+	return server.fragmentSize
+}
+
+// SetFragmentSize sets the default maximum payload size of each packet fragment.
+// Sizes below 1 would leave no room for the payload, so they are ignored and the current size is kept
+func (server *Server) SetFragmentSize(fragmentSize int16) {
+	if fragmentSize < 1 {
+		return
+	}
+
+	server.fragmentSize = fragmentSize
+}
+
+// SetMTU sets the default fragment size so that each DATA packet fits in a datagram of the given MTU.
+// An error is returned if the MTU leaves no room for a payload, and MTUs above what a fragment size can hold are capped
+// at the largest fragment size, 32767
+// The IPv4 and UDP headers (28 bytes) are subtracted first, followed by the PRUDP overhead of a DATA packet:
+//
+// PRUDPv0: 11 byte header, 3 bytes of options and a 4 byte checksum (1 byte with checksum version 1), so an MTU of 1500 gives a fragment size of 1454 (1457)
+//
+// PRUDPv1: 14 byte header, 16 byte signature and 3 bytes of options, so an MTU of 1500 gives a fragment size of 1439
+//
+// The overhead depends on the PRUDP and checksum versions, so this must be called after setting them. SetFragmentSize can still be used to override the result
+func (server *Server) SetMTU(mtu int) error {
+	overhead := 28
+
+	if server.PrudpVersion() == 0 {
+		overhead += 11 + 3
+
+		if server.ChecksumVersion() == 0 {
+			overhead += 4
+		} else {
+			overhead++
+		}
+	} else {
+		overhead += 14 + 16 + 3
+	}
+
+	fragmentSize := mtu - overhead
+
+	if fragmentSize < 1 {
+		return fmt.Errorf("[Server] MTU %d is too small for the %d byte packet overhead", mtu, overhead)
+	}
+
+	if fragmentSize > math.MaxInt16 {
+		fragmentSize = math.MaxInt16
+	}
+
+	server.SetFragmentSize(int16(fragmentSize))
+
+	return nil
+}
+
+// SetConnectionSignatureFunction sets the function used to generate the server connection signature sent to a client
+// in the SYN acknowledgement. Setting it to nil restores the default for the server PRUDP version, which is 4 zero
+// bytes for PRUDPv0 and 16 random bytes for PRUDPv1. Titles with a nonstandard handshake can override this
+func (server *Server) SetConnectionSignatureFunction(connectionSignature func(*Client) []byte) {
+	if connectionSignature == nil {
+		connectionSignature = server.defaultConnectionSignature
+	}
+
+	server.connectionSignature = connectionSignature
+}
+
+func (server *Server) defaultConnectionSignature(client *Client) []byte {
+	if server.PrudpVersion() == 0 {
+		return make([]byte, 4)
+	}
+
+	connectionSignature := make([]byte, 16)
+	rand.Read(connectionSignature)
+
+	return connectionSignature
+}
+
+// SetClock sets the function the server uses to get the current time, such as for rate limiting, the ping timeout and packet resends.
+// Setting it to nil restores time.Now. Timers wait on the system clock, then wait again if the server clock has not reached their deadline,
+// so a clock which is stopped delays them and one which is advanced fires them the next time they wake up
+func (server *Server) SetClock(clock func() time.Time) {
+	if clock == nil {
+		clock = time.Now
+	}
+
+	server.clock = clock
+}
+
+// Now returns the current time according to the server clock
+func (server *Server) Now() time.Time {
+	return server.clock()
+}
+
+// SetPacketMonitor sets a function which is called synchronously with every packet the server decodes or sends, including
+// acknowledgements. incoming is true for received packets. Sent packets are passed once they are encoded, so their payload is
+// already encrypted. Resends of reliable packets are not passed again. Setting it to nil removes the monitor
+func (server *Server) SetPacketMonitor(packetMonitor func(packet PacketInterface, incoming bool)) {
+	server.packetMonitor = packetMonitor
+}
+
+// SetPacketRateLimit limits how many datagrams are processed per second from each IP address, allowing bursts
+// of up to burst datagrams. Excess datagrams are dropped before being decoded. A perSecond of 0 disables the limit
+func (server *Server) SetPacketRateLimit(perSecond int, burst int) {
+	if perSecond <= 0 {
+		server.packetRateLimiter = nil
+	} else {
+		server.packetRateLimiter = NewRateLimiter(perSecond, burst)
+		server.packetRateLimiter.SetClock(server.Now)
+	}
+}
+
+// SetGlobalRateLimit limits how many datagrams are processed per second across all addresses, allowing bursts
+// of up to burst datagrams. Excess datagrams are dropped before being decoded. A perSecond of 0 disables the limit
+func (server *Server) SetGlobalRateLimit(perSecond int, burst int) {
+	if perSecond <= 0 {
+		server.globalRateLimiter = nil
+	} else {
+		server.globalRateLimiter = NewRateLimiter(perSecond, burst)
+		server.globalRateLimiter.SetClock(server.Now)
+	}
+}
+
+// SetPayloadTransform sets the functions applied to DATA packet payloads. inbound is applied to received payloads
+// before the RMC request is parsed, and outbound is applied to sent payloads before they are fragmented.
+// This allows for titles which wrap RMC messages in an extra envelope. Either function may be nil
+func (server *Server) SetPayloadTransform(inbound func([]byte) ([]byte, error), outbound func([]byte) ([]byte, error)) {
+	server.payloadTransformIn = inbound
+	server.payloadTransformOut = outbound
+}
+
+// SetDatagramTransform sets functions which wrap the PRUDP packets in another transport, such as the relay header used by
+// some titles. receive is applied to each datagram before it is decoded, including before the client discriminator is run,
+// and send is applied to the encoded packet before it is written to the socket. Either may be nil to leave that direction
+// untouched. Datagrams which fail the receive transform are dropped
+func (server *Server) SetDatagramTransform(receive func([]byte) ([]byte, error), send func([]byte) ([]byte, error)) {
+	server.datagramTransformIn = receive
+	server.datagramTransformOut = send
+}
+
+// SetClientDiscriminator sets the function used to build the key a client is stored under from the address and
+// raw data of each datagram it sends. By default clients are keyed by their address. When a custom discriminator
+// maps a datagram from a new address to an existing client, the client is moved to that address
+func (server *Server) SetClientDiscriminator(clientDiscriminator func(*net.UDPAddr, []byte) string) {
+	server.clientDiscriminator = clientDiscriminator
+}
+
+// defaultClientDiscriminator keys clients by their IP and port. The IPv6 zone is left out, as it can vary
+// between datagrams from the same client, and IPv4-mapped IPv6 addresses are keyed as plain IPv4
+func defaultClientDiscriminator(addr *net.UDPAddr, data []byte) string {
+	return net.JoinHostPort(addr.IP.String(), strconv.Itoa(addr.Port))
+}
+
+// SetAutoRespondUnhandled sets whether RMC requests to protocols with no handler are automatically answered with an error.
+// Requests are only answered automatically if no OnRMC or OnUnhandledRMC handler would run for them. RMC responses sent by the client are never answered
+func (server *Server) SetAutoRespondUnhandled(autoRespondUnhandled bool) {
+	server.autoRespondUnhandled = autoRespondUnhandled
+}
+
+// SetUnhandledRMCErrorCode sets the error code used when automatically answering unhandled RMC requests
+func (server *Server) SetUnhandledRMCErrorCode(errorCode uint32) {
+	server.unhandledRMCErrorCode = errorCode
+}
+
+// ResendTimeout returns the number of seconds to wait for a reliable packet to be acknowledged before resending it
+func (server *Server) ResendTimeout() float32 {
+	return server.resendTimeout
+}
+
+// SetResendTimeout sets the number of seconds to wait for a reliable packet to be acknowledged before resending it
+func (server *Server) SetResendTimeout(resendTimeout float32) {
+	server.resendTimeout = resendTimeout
+}
+
+// ResendJitter returns the maximum number of seconds randomly added to each resend timeout
+func (server *Server) ResendJitter() float32 {
+	return server.resendJitter
+}
+
+// SetResendJitter sets the maximum number of seconds randomly added to each resend timeout.
+// This spreads out the retransmission of packets which timed out at the same time
+func (server *Server) SetResendJitter(resendJitter float32) {
+	server.resendJitter = resendJitter
+}
+
+// ResendMaxIterations returns the number of times an unacknowledged reliable packet is resent before giving up
+func (server *Server) ResendMaxIterations() int {
+	return server.resendMaxIterations
+}
+
+// SetResendMaxIterations sets the number of times an unacknowledged reliable packet is resent before giving up
+func (server *Server) SetResendMaxIterations(resendMaxIterations int) {
+	server.resendMaxIterations = resendMaxIterations
+}
+
+// ReliableWindowSize returns the maximum number of unacknowledged reliable packets per client
+func (server *Server) ReliableWindowSize() int {
+	return server.reliableWindowSize
+}
+
+// SetReliableWindowSize sets the maximum number of unacknowledged reliable packets per client. Once a client's
+// window is full, further reliable packets are queued and sent as acknowledgements arrive. 0 disables the limit
+func (server *Server) SetReliableWindowSize(reliableWindowSize int) {
+	server.reliableWindowSize = reliableWindowSize
+}
+
 // UsePacketCompression enables or disables packet compression
 func (server *Server) UsePacketCompression(usePacketCompression bool) {
 	if usePacketCompression {
-		compression := ZLibCompression{}
-		server.SetPacketCompression(compression.Compress)
+		server.SetCompressionAlgorithm(&ZLibCompression{})
 	} else {
-		compression := DummyCompression{}
-		server.SetPacketCompression(compression.Compress)
+		server.SetCompressionAlgorithm(&DummyCompression{})
 	}
 
 	server.usePacketCompression = usePacketCompression
 }
 
-// SetPacketCompression sets the packet compression function
+// SetCompressionAlgorithm sets the algorithm used to compress outgoing and decompress incoming DATA packet payloads
+func (server *Server) SetCompressionAlgorithm(algorithm CompressionAlgorithm) {
+	server.SetPacketCompression(algorithm.Compress)
+	server.SetPacketDecompression(algorithm.Decompress)
+
+	_, uncompressed := algorithm.(*DummyCompression)
+	server.compressionPrefix = !uncompressed
+}
+
+// SetPacketCompression sets the packet compression function. Each fragment is compressed after the payload is fragmented,
+// so fragments are made 1 byte smaller than the fragment size to leave room for a compression ratio prefix like the ZLib one
 func (server *Server) SetPacketCompression(compression func([]byte) []byte) {
 	server.compressPacket = compression
+	server.compressionPrefix = true
+}
+
+// SetPacketDecompression sets the packet decompression function, applied to the payload of each incoming DATA packet before fragments are joined
+func (server *Server) SetPacketDecompression(decompression func([]byte) ([]byte, error)) {
+	server.decompressPacket = decompression
+}
+
+// Send writes data to client.
+// An error is returned if the payload can't be sent, such as when it needs more fragments than fragment IDs can number
+func (server *Server) Send(packet PacketInterface) error {
+	return server.send(packet, nil)
 }
 
-// Send writes data to client
-func (server *Server) Send(packet PacketInterface) {
+// SendReliable sends the packet reliably. onAck is called once every fragment of the packet has been acknowledged,
+// and onTimeout is called instead if any fragment is given up on after being resent too many times or the client is kicked.
+// Either callback may be nil. If an error is returned nothing was sent, and neither callback is called
+func (server *Server) SendReliable(packet PacketInterface, onAck func(), onTimeout func()) error {
+	packet.AddFlag(FlagReliable)
+	packet.AddFlag(FlagNeedsAck)
+
+	tracker := &reliableSendTracker{
+		onAck:     onAck,
+		onTimeout: onTimeout,
+	}
+
+	return server.send(packet, tracker)
+}
+
+// maxFragments is the most fragments a payload can be sent in. Fragment IDs are a single byte, fragments before the last are
+// numbered from 1 to 255 and the last one is numbered 0
+const maxFragments = 256
+
+func (server *Server) send(packet PacketInterface, tracker *reliableSendTracker) error {
+	// Handlers run on their own goroutines, so hold the client send lock while fragmenting to
+	// keep the fragments of one packet from being interleaved with those of another
+	client := packet.Sender()
+	client.sendMutex.Lock()
+	defer client.sendMutex.Unlock()
+
 	data := packet.Payload()
-	fragments := int(int16(len(data)) / server.fragmentSize)
 
-	fragmentID := 1
-	for i := 0; i <= fragments; i++ {
-		if int16(len(data)) < server.fragmentSize {
-			packet.SetPayload(data)
-			server.SendFragment(packet, 0)
-		} else {
-			packet.SetPayload(data[:server.fragmentSize])
-			server.SendFragment(packet, fragmentID)
+	if server.payloadTransformOut != nil && packet.Type() == DataPacket && len(data) > 0 {
+		transformed, err := server.payloadTransformOut(data)
 
-			data = data[server.fragmentSize:]
-			fragmentID++
+		if err != nil {
+			return err
 		}
+
+		data = transformed
+	}
+
+	fragmentSize := int(client.FragmentSize())
+
+	// Fragments are compressed after fragmenting, so room is left for the compression prefix
+	if server.compressionPrefix && fragmentSize > 1 {
+		fragmentSize--
+	}
+
+	fragments := 1
+
+	if len(data) > 0 {
+		fragments = (len(data)-1)/fragmentSize + 1
+	}
+
+	if fragments > maxFragments {
+		return fmt.Errorf("[Server] Payload of %d bytes needs %d fragments of %d bytes, more than the %d fragment IDs allow", len(data), fragments, fragmentSize, maxFragments)
+	}
+
+	if tracker != nil {
+		tracker.remaining = fragments
+	}
+
+	fragmentID := 1
+	for len(data) > fragmentSize {
+		packet.SetPayload(data[:fragmentSize])
+		server.sendFragment(packet, fragmentID, tracker)
+
+		data = data[fragmentSize:]
+		fragmentID++
 	}
+
+	packet.SetPayload(data)
+	server.sendFragment(packet, 0, tracker)
+
+	return nil
 }
 
 // SendFragment sends a packet fragment to the client
 func (server *Server) SendFragment(packet PacketInterface, fragmentID int) {
+	client := packet.Sender()
+	client.sendMutex.Lock()
+	defer client.sendMutex.Unlock()
+
+	server.sendFragment(packet, fragmentID, nil)
+}
+
+func (server *Server) sendFragment(packet PacketInterface, fragmentID int, tracker *reliableSendTracker) {
 	data := packet.Payload()
 	client := packet.Sender()
 
+	// The client may have been kicked while the packet was being built
+	if !server.ClientConnected(client) {
+		if tracker != nil {
+			tracker.timedOut()
+		}
+
+		return
+	}
+
 	packet.SetPayload(server.compressPacket(data))
+	packet.SetSessionID(client.SessionID())
 	packet.SetSequenceID(uint16(client.SequenceIDCounterOut().Increment()))
+	packet.SetFragmentID(uint8(fragmentID))
+
+	// Each fragment declares its own payload size so fragments can be delimited on the receiving end
+	if packet.Type() == DataPacket {
+		packet.AddFlag(FlagHasSize)
+	}
 
 	encodedPacket := packet.Bytes()
 
+	if server.packetMonitor != nil {
+		server.packetMonitor(packet, false)
+	}
+
+	if packet.HasFlag(FlagReliable) && packet.HasFlag(FlagNeedsAck) {
+		if !client.ResendScheduler().addPacket(packet.SequenceID(), encodedPacket, tracker) {
+			// Queued until the reliable window has space
+			return
+		}
+	}
+
 	server.SendRaw(client.Address(), encodedPacket)
 }
 
 // SendRaw writes raw packet data to the client socket
 func (server *Server) SendRaw(conn *net.UDPAddr, data []byte) {
+	if server.datagramTransformOut != nil {
+		transformed, err := server.datagramTransformOut(data)
+
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+
+		data = transformed
+	}
+
 	server.Socket().WriteToUDP(data, conn)
 }
 
@@ -446,19 +1748,34 @@ func NewServer() *Server {
 		genericEventHandles:   make(map[string][]func(PacketInterface)),
 		prudpV0EventHandles:   make(map[string][]func(*PacketV0)),
 		prudpV1EventHandles:   make(map[string][]func(*PacketV1)),
+		packetEventHandles:    make(map[string][]func(*PacketEvent)),
+		rmcEventHandles:       make(map[uint16][]func(PacketInterface)),
 		clients:               make(map[string]*Client),
+		clientsByPID:          make(map[uint64]*Client),
+		clientsByConnectionID: make(map[uint32]*Client),
+		recentPIDs:            make(map[uint64]recentPID),
+		connectionIDCounter:   NewCounter(0),
+		migrationRateLimiter:  NewRateLimiter(1, 5),
 		prudpVersion:          1,
 		fragmentSize:          1300,
 		resendTimeout:         1.5,
-		pingTimeout:           5,
+		resendJitter:          0.5,
+		resendMaxIterations:   5,
+		pingTimeout:           5 * time.Second,
 		signatureVersion:      0,
 		flagsVersion:          1,
 		checksumVersion:       1,
 		kerberosKeySize:       32,
 		kerberosKeyDerivation: 0,
+		unhandledRMCErrorCode: uint32(QErrorCoreNotImplemented),
 	}
 
 	server.UsePacketCompression(false)
+	server.SetConnectionSignatureFunction(nil)
+	server.SetClock(nil)
+	server.migrationRateLimiter.SetClock(server.Now)
+	server.SetReadBufferSize(64000)
+	server.SetClientDiscriminator(defaultClientDiscriminator)
 
 	return server
 }
@@ -0,0 +1,61 @@
+package nex
+
+import "time"
+
+// ServerConfig is a snapshot of the effective server configuration. Secrets such as the access key are left out
+type ServerConfig struct {
+	HasAccessKey          bool
+	PrudpVersion          int
+	NexVersion            int
+	IsSecureServer        bool
+	StrictDatagramParsing bool
+	FragmentSize          int16
+	ResendTimeout         float32
+	ResendJitter          float32
+	ResendMaxIterations   int
+	ReliableWindowSize    int
+	UsePacketCompression  bool
+	PingTimeout           time.Duration
+	ReconnectionWindow    time.Duration
+	SignatureVersion      int
+	FlagsVersion          int
+	ChecksumVersion       int
+	KerberosKeySize       int
+	KerberosKeyDerivation int
+	ServerVersion         int
+	SocketReadBufferSize  int
+	SocketWriteBufferSize int
+	ReadBufferSize        int
+	AutoRespondUnhandled  bool
+	UnhandledRMCErrorCode uint32
+}
+
+// Config returns a snapshot of the server configuration
+func (server *Server) Config() ServerConfig {
+	return ServerConfig{
+		HasAccessKey:          server.accessKey != "",
+		PrudpVersion:          server.prudpVersion,
+		NexVersion:            server.nexVersion,
+		IsSecureServer:        server.isSecureServer,
+		StrictDatagramParsing: server.strictDatagramParsing,
+		FragmentSize:          server.fragmentSize,
+		ResendTimeout:         server.resendTimeout,
+		ResendJitter:          server.resendJitter,
+		ResendMaxIterations:   server.resendMaxIterations,
+		ReliableWindowSize:    server.reliableWindowSize,
+		UsePacketCompression:  server.usePacketCompression,
+		PingTimeout:           server.pingTimeout,
+		ReconnectionWindow:    server.reconnectionWindow,
+		SignatureVersion:      server.signatureVersion,
+		FlagsVersion:          server.flagsVersion,
+		ChecksumVersion:       server.checksumVersion,
+		KerberosKeySize:       server.kerberosKeySize,
+		KerberosKeyDerivation: server.kerberosKeyDerivation,
+		ServerVersion:         server.serverVersion,
+		SocketReadBufferSize:  server.socketReadBufferSize,
+		SocketWriteBufferSize: server.socketWriteBufferSize,
+		ReadBufferSize:        server.readBufferSize,
+		AutoRespondUnhandled:  server.autoRespondUnhandled,
+		UnhandledRMCErrorCode: server.unhandledRMCErrorCode,
+	}
+}
@@ -0,0 +1,87 @@
+package nex
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServerConfigReflectsSetters(t *testing.T) {
+	server := NewServer()
+
+	if server.Config().HasAccessKey {
+		t.Error("Server without an access key reports having one")
+	}
+
+	server.SetAccessKey("ridfebb9")
+	server.SetPrudpVersion(0)
+	server.SetNexVersion(30500)
+	server.SetIsSecureServer(true)
+	server.SetStrictDatagramParsing(true)
+	server.SetFragmentSize(1000)
+	server.SetResendTimeout(2)
+	server.SetResendJitter(0.25)
+	server.SetResendMaxIterations(7)
+	server.SetReliableWindowSize(32)
+	server.UsePacketCompression(true)
+	server.SetPingTimeout(10 * time.Second)
+	server.SetReconnectionWindow(time.Minute)
+	server.SetSignatureVersion(1)
+	server.SetFlagsVersion(0)
+	server.SetChecksumVersion(0)
+	server.SetKerberosKeySize(16)
+	server.SetReadKernelBuffer(1 << 20)
+	server.SetWriteKernelBuffer(1 << 19)
+	server.SetReadBufferSize(2048)
+	server.SetAutoRespondUnhandled(true)
+	server.SetUnhandledRMCErrorCode(0x80010001)
+
+	expected := ServerConfig{
+		HasAccessKey:          true,
+		PrudpVersion:          0,
+		NexVersion:            30500,
+		IsSecureServer:        true,
+		StrictDatagramParsing: true,
+		FragmentSize:          1000,
+		ResendTimeout:         2,
+		ResendJitter:          0.25,
+		ResendMaxIterations:   7,
+		ReliableWindowSize:    32,
+		UsePacketCompression:  true,
+		PingTimeout:           10 * time.Second,
+		ReconnectionWindow:    time.Minute,
+		SignatureVersion:      1,
+		FlagsVersion:          0,
+		ChecksumVersion:       0,
+		KerberosKeySize:       16,
+		KerberosKeyDerivation: 0,
+		ServerVersion:         0,
+		SocketReadBufferSize:  1 << 20,
+		SocketWriteBufferSize: 1 << 19,
+		ReadBufferSize:        2048,
+		AutoRespondUnhandled:  true,
+		UnhandledRMCErrorCode: 0x80010001,
+	}
+
+	if config := server.Config(); config != expected {
+		t.Errorf("Config does not reflect the setters\nexpected: %+v\ngot:      %+v", expected, config)
+	}
+}
+
+func TestServerRejectsNonPositiveReadBufferSize(t *testing.T) {
+	server := NewServer()
+
+	for _, size := range []int{0, -1} {
+		if err := server.SetReadBufferSize(size); err == nil {
+			t.Errorf("SetReadBufferSize(%d) did not return an error", size)
+		}
+	}
+
+	if server.ReadBufferSize() != 64000 {
+		t.Errorf("Read buffer size changed to %d after rejected sizes", server.ReadBufferSize())
+	}
+
+	buffer := server.readBufferPool.Get().(*[]byte)
+	if len(*buffer) != 64000 {
+		t.Errorf("Read buffer pool allocates %d byte buffers, expected 64000", len(*buffer))
+	}
+}
@@ -0,0 +1,49 @@
+package nex
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestServerKernelBufferSizes(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetReadKernelBuffer(16384)
+		server.SetWriteKernelBuffer(32768)
+	})
+
+	rawConn, err := server.Socket().SyscallConn()
+
+	if err != nil {
+		t.Fatalf("SyscallConn failed: %v", err)
+	}
+
+	var readBufferSize, writeBufferSize int
+	var sockoptErr error
+
+	err = rawConn.Control(func(fd uintptr) {
+		readBufferSize, sockoptErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF)
+
+		if sockoptErr != nil {
+			return
+		}
+
+		writeBufferSize, sockoptErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF)
+	})
+
+	if err != nil {
+		t.Fatalf("Control failed: %v", err)
+	}
+
+	if sockoptErr != nil {
+		t.Fatalf("Getsockopt failed: %v", sockoptErr)
+	}
+
+	// Linux doubles the requested size to leave room for bookkeeping
+	if readBufferSize != 2*16384 {
+		t.Errorf("SO_RCVBUF = %d, want %d", readBufferSize, 2*16384)
+	}
+
+	if writeBufferSize != 2*32768 {
+		t.Errorf("SO_SNDBUF = %d, want %d", writeBufferSize, 2*32768)
+	}
+}
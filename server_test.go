@@ -0,0 +1,1468 @@
+package nex
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testTimeout is how long tests wait for a packet or event before failing
+const testTimeout = 2 * time.Second
+
+// testServer is a Server listening on loopback for a test, along with the clients which completed the handshake
+type testServer struct {
+	*Server
+	connected chan *Client
+}
+
+// newTestServer starts a PRUDPv1 server on a random loopback port, which is shut down when the test ends.
+// Handlers must be registered in configure, as they can't be added once the server is listening
+func newTestServer(t *testing.T, configure func(server *Server)) *testServer {
+	t.Helper()
+
+	server := &testServer{
+		Server:    NewServer(),
+		connected: make(chan *Client, 16),
+	}
+
+	server.SetAccessKey("ridfebb9")
+	server.SetNexVersion(2)
+
+	// Handlers run after the server is done with the packet, so clients handed over here are safe to use from the test
+	server.OnClientConnected(func(packet PacketInterface) {
+		server.connected <- packet.Sender()
+	})
+
+	if configure != nil {
+		configure(server.Server)
+	}
+
+	ready, errc := server.ListenAsync("127.0.0.1:0")
+
+	select {
+	case <-ready:
+	case err := <-errc:
+		t.Fatalf("Listen failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		server.Shutdown()
+	})
+
+	return server
+}
+
+// testClient is a PRUDPv1 client talking to a test server over loopback
+type testClient struct {
+	t          *testing.T
+	server     *testServer
+	conn       *net.UDPConn
+	peer       *Client
+	client     *Client
+	sessionID  uint8
+	sequenceID uint16
+}
+
+// newTestClient returns a testClient for the server. Its peer is a Client of a server with the same settings,
+// used to encode the packets sent to the server and decode the ones it sends back
+func newTestClient(t *testing.T, server *testServer) *testClient {
+	t.Helper()
+
+	conn, err := net.DialUDP("udp", nil, server.Socket().LocalAddr().(*net.UDPAddr))
+
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	peerServer := NewServer()
+	peerServer.SetAccessKey(server.AccessKey())
+	peerServer.SetNexVersion(server.NexVersion())
+	peerServer.SetPrudpVersion(server.PrudpVersion())
+	peerServer.SetFlagsVersion(server.FlagsVersion())
+
+	return &testClient{
+		t:         t,
+		server:    server,
+		conn:      conn,
+		peer:      NewClient(conn.RemoteAddr().(*net.UDPAddr), peerServer),
+		sessionID: 0x2A,
+	}
+}
+
+// rebind moves the client to a new local port, as if a NAT had changed its mapping
+func (client *testClient) rebind() {
+	client.t.Helper()
+
+	conn, err := net.DialUDP("udp", nil, client.conn.RemoteAddr().(*net.UDPAddr))
+
+	if err != nil {
+		client.t.Fatalf("Dial failed: %v", err)
+	}
+
+	client.t.Cleanup(func() {
+		conn.Close()
+	})
+
+	client.conn.Close()
+	client.conn = conn
+}
+
+// newPacket returns a packet from the client to the server
+func (client *testClient) newPacket(packetType uint16, flags uint16) *PacketV1 {
+	packet, _ := NewPacketV1(client.peer, nil)
+
+	packet.SetVersion(1)
+	packet.SetSource(0xAF)
+	packet.SetDestination(0xA1)
+	packet.SetType(packetType)
+	packet.SetFlags(flags)
+	packet.SetSessionID(client.sessionID)
+
+	return packet
+}
+
+// sendPacket encodes and sends the packet to the server
+func (client *testClient) sendPacket(packet *PacketV1) {
+	client.t.Helper()
+
+	_, err := client.conn.Write(packet.Bytes())
+
+	if err != nil {
+		client.t.Fatalf("Write failed: %v", err)
+	}
+}
+
+// receive returns the next packet the server sends which is not an acknowledgement of a DATA packet
+func (client *testClient) receive() *PacketV1 {
+	client.t.Helper()
+
+	buffer := make([]byte, 64000)
+
+	for {
+		client.conn.SetReadDeadline(time.Now().Add(testTimeout))
+
+		length, err := client.conn.Read(buffer)
+
+		if err != nil {
+			client.t.Fatalf("Read failed: %v", err)
+		}
+
+		packet, err := NewPacketV1(client.peer, append([]byte{}, buffer[:length]...))
+
+		if err != nil {
+			client.t.Fatalf("Failed to decode packet from the server: %v", err)
+		}
+
+		if packet.Type() == DataPacket && packet.HasFlag(FlagMultiAck) {
+			continue
+		}
+
+		if packet.Type() == DataPacket {
+			packet.decipherPayload()
+		}
+
+		return packet
+	}
+}
+
+// expectNothing fails the test if the server sends anything other than acknowledgements before the wait is over
+func (client *testClient) expectNothing(wait time.Duration) {
+	client.t.Helper()
+
+	buffer := make([]byte, 64000)
+	deadline := time.Now().Add(wait)
+
+	for {
+		client.conn.SetReadDeadline(deadline)
+
+		length, err := client.conn.Read(buffer)
+
+		if err != nil {
+			return
+		}
+
+		packet, err := NewPacketV1(client.peer, append([]byte{}, buffer[:length]...))
+
+		if err == nil && (packet.HasFlag(FlagAck) || packet.HasFlag(FlagMultiAck)) {
+			continue
+		}
+
+		client.t.Fatalf("Unexpected packet from the server: % X", buffer[:length])
+	}
+}
+
+// syn sends a SYN to the server, returning its acknowledgement
+func (client *testClient) syn() *PacketV1 {
+	client.t.Helper()
+
+	syn := client.newPacket(SynPacket, FlagNeedsAck)
+	syn.SetSessionID(0)
+	syn.SetConnectionSignature(make([]byte, 16))
+	client.sendPacket(syn)
+
+	synAck := client.receive()
+
+	if synAck.Type() != SynPacket || !synAck.HasFlag(FlagAck) {
+		client.t.Fatalf("Expected a SYN acknowledgement, got type %d flags %X", synAck.Type(), synAck.Flags())
+	}
+
+	return synAck
+}
+
+// connect performs the SYN/CONNECT handshake, returning the CONNECT acknowledgement.
+// Once it returns, the client stored by the server is available in client.client
+func (client *testClient) connect(payload []byte) *PacketV1 {
+	client.t.Helper()
+
+	synAck := client.syn()
+
+	clientSignature := make([]byte, 16)
+	rand.Read(clientSignature)
+
+	client.peer.SetClientConnectionSignature(synAck.ConnectionSignature())
+	client.peer.SetServerConnectionSignature(clientSignature)
+
+	client.sequenceID = 1
+
+	connect := client.newPacket(ConnectPacket, FlagReliable|FlagNeedsAck)
+	connect.SetSequenceID(client.sequenceID)
+	connect.SetConnectionSignature(clientSignature)
+	connect.SetPayload(payload)
+	client.sendPacket(connect)
+
+	connectAck := client.receive()
+
+	if connectAck.Type() != ConnectPacket || !connectAck.HasFlag(FlagAck) {
+		client.t.Fatalf("Expected a CONNECT acknowledgement, got type %d flags %X", connectAck.Type(), connectAck.Flags())
+	}
+
+	select {
+	case client.client = <-client.server.connected:
+	case <-time.After(testTimeout):
+		client.t.Fatal("Timed out waiting for the client to connect")
+	}
+
+	return connectAck
+}
+
+// testSessionKey is the session key the test secure server gives clients when they connect
+var testSessionKey = []byte{
+	0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F,
+	0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1A, 0x1B, 0x1C, 0x1D, 0x1E, 0x1F,
+}
+
+// authenticateOnConnect makes the secure server give each client testSessionKey when it connects,
+// in place of the application decrypting the Kerberos ticket in the CONNECT payload
+func authenticateOnConnect(server *Server) {
+	server.SetIsSecureServer(true)
+
+	server.On("Connect", func(packet PacketInterface) {
+		packet.Sender().SetSessionKey(testSessionKey)
+		server.AcknowledgePacket(packet, []byte{0x04, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00})
+	})
+}
+
+// authenticate connects to a server set up with authenticateOnConnect and signs the following packets with the session key
+func (client *testClient) authenticate() {
+	client.t.Helper()
+
+	client.connect([]byte{0x01, 0x02, 0x03, 0x04})
+	client.peer.SetSessionKey(testSessionKey)
+}
+
+// newDataPacket returns the next reliable DATA packet from the client
+func (client *testClient) newDataPacket(payload []byte, fragmentID uint8) *PacketV1 {
+	client.sequenceID++
+
+	packet := client.newPacket(DataPacket, FlagReliable|FlagNeedsAck|FlagHasSize)
+	packet.SetSequenceID(client.sequenceID)
+	packet.SetFragmentID(fragmentID)
+	packet.SetPayload(payload)
+
+	return packet
+}
+
+// sendData sends the payload to the server in a single reliable DATA packet
+func (client *testClient) sendData(payload []byte) {
+	client.sendPacket(client.newDataPacket(payload, 0))
+}
+
+// newTestRMCRequest returns an RMC request payload for the protocol and method
+func newTestRMCRequest(protocolID uint16, callID uint32, methodID uint32, parameters []byte) []byte {
+	stream := NewStreamOut(nil)
+
+	if protocolID < 0x7F {
+		stream.WriteUInt8(uint8(protocolID) | 0x80)
+	} else {
+		stream.WriteUInt8(0x7F | 0x80)
+		stream.WriteUInt16LE(protocolID)
+	}
+
+	stream.WriteUInt32LE(callID)
+	stream.WriteUInt32LE(methodID)
+	stream.Grow(int64(len(parameters)))
+	stream.WriteBytesNext(parameters)
+
+	data := NewStreamOut(nil)
+	data.WriteBuffer(stream.Bytes())
+
+	return data.Bytes()
+}
+
+func TestServerSendsFragmentsWithSizes(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetFragmentSize(16)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	payload := make([]byte, 50)
+	rand.Read(payload)
+
+	packet, _ := NewPacketV1(client.client, nil)
+	packet.SetSource(0xA1)
+	packet.SetDestination(0xAF)
+	packet.SetType(DataPacket)
+	packet.SetPayload(payload)
+	packet.AddFlag(FlagNeedsAck)
+	packet.AddFlag(FlagReliable)
+
+	server.Send(packet)
+
+	var reassembled []byte
+
+	for _, expectedFragmentID := range []uint8{1, 2, 3, 0} {
+		fragment := client.receive()
+
+		if fragment.Type() != DataPacket {
+			t.Fatalf("Expected a DATA packet, got type %d", fragment.Type())
+		}
+
+		if !fragment.HasFlag(FlagHasSize) {
+			t.Errorf("Fragment %d is missing the has size flag", expectedFragmentID)
+		}
+
+		if fragment.FragmentID() != expectedFragmentID {
+			t.Errorf("Expected fragment ID %d, got %d", expectedFragmentID, fragment.FragmentID())
+		}
+
+		payloadSize := binary.LittleEndian.Uint16(fragment.Data()[4:6])
+
+		if int(payloadSize) != len(fragment.Payload()) {
+			t.Errorf("Fragment %d declares a payload size of %d but carries %d bytes", expectedFragmentID, payloadSize, len(fragment.Payload()))
+		}
+
+		if len(fragment.Payload()) > 16 {
+			t.Errorf("Fragment %d is larger than the fragment size", expectedFragmentID)
+		}
+
+		reassembled = append(reassembled, fragment.deciphered...)
+	}
+
+	if !bytes.Equal(reassembled, payload) {
+		t.Errorf("Reassembled payload does not match\nexpected: % X\ngot:      % X", payload, reassembled)
+	}
+
+	// Only DATA packets declare their size
+	server.SendPing(client.client)
+
+	ping := client.receive()
+
+	if ping.Type() != PingPacket || ping.HasFlag(FlagHasSize) {
+		t.Errorf("Expected a PING without the has size flag, got type %d flags %X", ping.Type(), ping.Flags())
+	}
+}
+
+func TestServerFragmentIDLimit(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetFragmentSize(1)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	newPacket := func(payloadSize int) PacketInterface {
+		packet, _ := NewPacketV1(client.client, nil)
+		packet.SetSource(0xA1)
+		packet.SetDestination(0xAF)
+		packet.SetType(DataPacket)
+		packet.SetPayload(make([]byte, payloadSize))
+
+		return packet
+	}
+
+	// Fragments 1 to 255 followed by the final fragment 0
+	if err := server.Send(newPacket(maxFragments)); err != nil {
+		t.Errorf("Expected a payload of %d fragments to be sent, got %v", maxFragments, err)
+	}
+
+	for i := 1; i <= maxFragments; i++ {
+		fragment := client.receive()
+
+		if fragment.FragmentID() != uint8(i%maxFragments) {
+			t.Fatalf("Expected fragment ID %d, got %d", uint8(i%maxFragments), fragment.FragmentID())
+		}
+	}
+
+	// One more fragment would wrap the fragment ID around to 0, which marks the final fragment
+	if err := server.Send(newPacket(maxFragments + 1)); err == nil {
+		t.Error("Expected an error for a payload needing more fragments than fragment IDs allow")
+	}
+
+	client.expectNothing(100 * time.Millisecond)
+}
+
+func TestServerReassemblesFragments(t *testing.T) {
+	requests := make(chan PacketInterface, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.OnRMC(0x0A, func(packet PacketInterface) {
+			requests <- packet
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	parameters := make([]byte, 40)
+	rand.Read(parameters)
+
+	payload := newTestRMCRequest(0x0A, 1, 2, parameters)
+
+	client.sendPacket(client.newDataPacket(payload[:20], 1))
+	client.sendPacket(client.newDataPacket(payload[20:40], 2))
+	client.sendPacket(client.newDataPacket(payload[40:], 0))
+
+	var request RMCRequest
+
+	select {
+	case packet := <-requests:
+		request = packet.RMCRequest()
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the reassembled RMC request")
+	}
+
+	if request.MethodID() != 2 || !bytes.Equal(request.Parameters(), parameters) {
+		t.Errorf("Reassembled request does not match, got method %d parameters % X", request.MethodID(), request.Parameters())
+	}
+}
+
+func TestServerCompressedFragments(t *testing.T) {
+	requests := make(chan RMCRequest, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.SetCompressionAlgorithm(&ZLibCompression{})
+		server.SetFragmentSize(32)
+
+		server.OnRMC(0x0A, func(packet PacketInterface) {
+			requests <- packet.RMCRequest()
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	compression := &ZLibCompression{}
+	parameters := bytes.Repeat([]byte{0x01, 0x02, 0x03, 0x04}, 150)
+	payload := newTestRMCRequest(0x0A, 1, 2, parameters)
+
+	// Each fragment is compressed on its own, as clients do
+	for offset := 0; offset < len(payload); offset += 250 {
+		end := offset + 250
+		fragmentID := uint8(offset/250 + 1)
+
+		if end >= len(payload) {
+			end = len(payload)
+			fragmentID = 0
+		}
+
+		compressed := compression.Compress(payload[offset:end])
+
+		if compressed[0] == 0 {
+			t.Fatalf("Fragment %d was not compressed", fragmentID)
+		}
+
+		client.sendPacket(client.newDataPacket(compressed, fragmentID))
+	}
+
+	select {
+	case request := <-requests:
+		if !bytes.Equal(request.Parameters(), parameters) {
+			t.Errorf("Expected the parameters of every fragment, got % X", request.Parameters())
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the compressed RMC request")
+	}
+
+	// Random data doesn't compress, so every fragment is the data with a 0 prefix, which has to fit in the fragment size
+	data := make([]byte, 100)
+	rand.Read(data)
+
+	packet, _ := NewPacketV1(client.client, nil)
+	packet.SetSource(0xA1)
+	packet.SetDestination(0xAF)
+	packet.SetType(DataPacket)
+	packet.SetPayload(data)
+
+	server.Send(packet)
+
+	var received []byte
+
+	for {
+		fragment := client.receive()
+
+		if len(fragment.Payload()) > 32 {
+			t.Errorf("Fragment %d is %d bytes, larger than the fragment size", fragment.FragmentID(), len(fragment.Payload()))
+		}
+
+		decompressed, err := compression.Decompress(fragment.deciphered)
+
+		if err != nil {
+			t.Fatalf("Failed to decompress fragment %d: %v", fragment.FragmentID(), err)
+		}
+
+		received = append(received, decompressed...)
+
+		if fragment.FragmentID() == 0 {
+			break
+		}
+	}
+
+	if !bytes.Equal(received, data) {
+		t.Errorf("Expected the sent data % X, got % X", data, received)
+	}
+}
+
+func TestServerReliablePayloadWithInvalidRMC(t *testing.T) {
+	payloads := make(chan []byte, 1)
+	dropped := make(chan string, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.OnReliablePayload(func(client *Client, payload []byte) {
+			payloads <- payload
+		})
+
+		server.OnPacketDropped(func(address *net.UDPAddr, reason string) {
+			dropped <- reason
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	// The RMC size claims far more data than the fragments carry, so parsing the request fails
+	payload := make([]byte, 32)
+	rand.Read(payload)
+	binary.LittleEndian.PutUint32(payload, 0xFFFF)
+
+	client.sendPacket(client.newDataPacket(payload[:16], 1))
+	client.sendPacket(client.newDataPacket(payload[16:], 0))
+
+	select {
+	case received := <-payloads:
+		if !bytes.Equal(received, payload) {
+			t.Errorf("Expected the reassembled payload % X, got % X", payload, received)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the reliable payload")
+	}
+
+	select {
+	case reason := <-dropped:
+		if !strings.Contains(reason, "Error parsing RMC request") {
+			t.Errorf("Unexpected drop reason %q", reason)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the invalid RMC request to be dropped")
+	}
+}
+
+func TestServerAcknowledgesSyn(t *testing.T) {
+	for _, isSecureServer := range []bool{false, true} {
+		server := newTestServer(t, func(server *Server) {
+			server.SetIsSecureServer(isSecureServer)
+		})
+
+		client := newTestClient(t, server)
+		synAck := client.syn()
+
+		if synAck.SequenceID() != 0 || synAck.SessionID() != 0 || synAck.MaximumSubstreamID() != 0 {
+			t.Errorf("Secure server %t: unexpected SYN acknowledgement header, sequence ID %d session ID %d maximum substream ID %d",
+				isSecureServer, synAck.SequenceID(), synAck.SessionID(), synAck.MaximumSubstreamID())
+		}
+
+		connectionSignature := synAck.ConnectionSignature()
+
+		if len(connectionSignature) != 16 || bytes.Equal(connectionSignature, make([]byte, 16)) {
+			t.Errorf("Secure server %t: expected a random 16 byte connection signature, got %X", isSecureServer, connectionSignature)
+		}
+
+		// A SYN from the same address starts a new handshake with a new connection signature
+		secondSynAck := client.syn()
+
+		if bytes.Equal(secondSynAck.ConnectionSignature(), connectionSignature) {
+			t.Errorf("Secure server %t: resent SYN reused the connection signature", isSecureServer)
+		}
+	}
+}
+
+func TestServerSynDuringSend(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			packet, _ := NewPacketV1(client.client, nil)
+			packet.SetSource(0xA1)
+			packet.SetDestination(0xAF)
+			packet.SetType(DataPacket)
+			packet.SetPayload([]byte{0x01, 0x02, 0x03, 0x04})
+			packet.AddFlag(FlagNeedsAck)
+			packet.AddFlag(FlagReliable)
+
+			server.Send(packet)
+		}
+	}()
+
+	// The SYN resets the client while packets are being sent to it, which the race detector checks
+	syn := client.newPacket(SynPacket, FlagNeedsAck)
+	syn.SetSessionID(0)
+	syn.SetConnectionSignature(make([]byte, 16))
+	client.sendPacket(syn)
+
+	time.Sleep(50 * time.Millisecond)
+	close(done)
+	<-stopped
+}
+
+func TestServerClientDiscriminator(t *testing.T) {
+	requests := make(chan PacketInterface, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		// Key clients by IP only, so a client keeps its session when its port changes
+		server.SetClientDiscriminator(func(addr *net.UDPAddr, data []byte) string {
+			return addr.IP.String()
+		})
+
+		server.OnRMC(0x0A, func(packet PacketInterface) {
+			requests <- packet
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	client.rebind()
+	client.sendData(newTestRMCRequest(0x0A, 1, 1, nil))
+
+	select {
+	case packet := <-requests:
+		if packet.Sender() != client.client {
+			t.Error("The packet from the new port was handled as a new client")
+		}
+
+		if packet.Sender().Address().String() != client.conn.LocalAddr().String() {
+			t.Errorf("Expected the client address to be updated to %s, got %s", client.conn.LocalAddr(), packet.Sender().Address())
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the RMC request from the new port")
+	}
+
+	if len(server.Clients()) != 1 {
+		t.Errorf("Expected 1 client, got %d", len(server.Clients()))
+	}
+}
+
+func TestServerMigratesAuthenticatedClient(t *testing.T) {
+	requests := make(chan PacketInterface, 1)
+	migrations := make(chan [2]*net.UDPAddr, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		authenticateOnConnect(server)
+
+		server.OnRMC(0x0A, func(packet PacketInterface) {
+			requests <- packet
+		})
+
+		server.OnClientMigrated(func(client *Client, oldAddress *net.UDPAddr, newAddress *net.UDPAddr) {
+			migrations <- [2]*net.UDPAddr{oldAddress, newAddress}
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.authenticate()
+
+	oldAddress := client.conn.LocalAddr().String()
+
+	client.rebind()
+	client.sendData(newTestRMCRequest(0x0A, 1, 1, nil))
+
+	select {
+	case packet := <-requests:
+		if packet.Sender() != client.client {
+			t.Error("The packet from the new port was handled as a new client")
+		}
+
+		if packet.Sender().Address().String() != client.conn.LocalAddr().String() {
+			t.Errorf("Expected the client address to be updated to %s, got %s", client.conn.LocalAddr(), packet.Sender().Address())
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the RMC request from the new port")
+	}
+
+	if len(server.Clients()) != 1 {
+		t.Errorf("Expected 1 client, got %d", len(server.Clients()))
+	}
+
+	select {
+	case addresses := <-migrations:
+		if addresses[0].String() != oldAddress || addresses[1].String() != client.conn.LocalAddr().String() {
+			t.Errorf("Expected a migration from %s to %s, got %s to %s", oldAddress, client.conn.LocalAddr(), addresses[0], addresses[1])
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the migration event")
+	}
+}
+
+func TestServerDoesNotMigrateReplayedPacket(t *testing.T) {
+	requests := make(chan PacketInterface, 2)
+
+	server := newTestServer(t, func(server *Server) {
+		authenticateOnConnect(server)
+
+		server.OnRMC(0x0A, func(packet PacketInterface) {
+			requests <- packet
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.authenticate()
+
+	data := client.newDataPacket(newTestRMCRequest(0x0A, 1, 1, nil), 0).Bytes()
+
+	client.conn.Write(data)
+
+	select {
+	case <-requests:
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the RMC request")
+	}
+
+	// The same datagram captured and sent from another address is not newer than what the client already sent
+	attacker, err := net.DialUDP("udp", nil, client.conn.RemoteAddr().(*net.UDPAddr))
+
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+
+	defer attacker.Close()
+
+	attacker.Write(data)
+
+	select {
+	case <-requests:
+		t.Error("The replayed packet was handled")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if client.client.Address().String() != client.conn.LocalAddr().String() {
+		t.Errorf("The replayed packet moved the client to %s", client.client.Address())
+	}
+}
+
+func TestServerSequenceGap(t *testing.T) {
+	type gap struct {
+		expected uint16
+		got      uint16
+	}
+
+	gaps := make(chan gap, 1)
+	requests := make(chan PacketInterface, 2)
+
+	server := newTestServer(t, func(server *Server) {
+		server.OnSequenceGap(func(client *Client, expected uint16, got uint16) {
+			gaps <- gap{expected, got}
+		})
+
+		server.OnRMC(0x0A, func(packet PacketInterface) {
+			requests <- packet
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	// The CONNECT was sequence ID 1. Packets are encoded in order, as the RC4 stream depends on it
+	second := client.newDataPacket(newTestRMCRequest(0x0A, 2, 1, nil), 0).Bytes()
+	third := client.newDataPacket(newTestRMCRequest(0x0A, 3, 1, nil), 0).Bytes()
+
+	client.conn.Write(third)
+
+	select {
+	case gap := <-gaps:
+		if gap.expected != 2 || gap.got != 3 {
+			t.Errorf("Expected a gap from 2 to 3, got %d to %d", gap.expected, gap.got)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the sequence gap")
+	}
+
+	select {
+	case <-requests:
+		t.Fatal("The packet after the gap was handled before the missing packet arrived")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	client.conn.Write(second)
+
+	var callIDs []uint32
+
+	for len(callIDs) < 2 {
+		select {
+		case packet := <-requests:
+			request := packet.RMCRequest()
+			callIDs = append(callIDs, request.CallID())
+		case <-time.After(testTimeout):
+			t.Fatal("Timed out waiting for the held packet to be handled")
+		}
+	}
+
+	// Handlers run on their own goroutines, so only check both requests were deciphered correctly
+	if !(callIDs[0] == 2 && callIDs[1] == 3) && !(callIDs[0] == 3 && callIDs[1] == 2) {
+		t.Errorf("Expected the requests with call IDs 2 and 3, got %v", callIDs)
+	}
+}
+
+func TestServerRoutesRMCByProtocol(t *testing.T) {
+	type routed struct {
+		handler    string
+		protocolID uint16
+		callID     uint32
+	}
+
+	routes := make(chan routed, 3)
+
+	server := newTestServer(t, func(server *Server) {
+		server.OnRMC(0x0A, func(packet PacketInterface) {
+			request := packet.RMCRequest()
+			routes <- routed{"0x0A", request.FullProtocolID(), request.CallID()}
+		})
+
+		// Extended protocol IDs are sent as 0x7F followed by the real ID
+		server.OnRMC(0x0123, func(packet PacketInterface) {
+			request := packet.RMCRequest()
+			routes <- routed{"0x0123", request.FullProtocolID(), request.CallID()}
+		})
+
+		server.OnUnhandledRMC(func(packet PacketInterface) {
+			request := packet.RMCRequest()
+			routes <- routed{"unhandled", request.FullProtocolID(), request.CallID()}
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	expected := []routed{
+		{"0x0A", 0x0A, 1},
+		{"0x0123", 0x0123, 2},
+		{"unhandled", 0x0B, 3},
+	}
+
+	for _, route := range expected {
+		client.sendData(newTestRMCRequest(route.protocolID, route.callID, 1, nil))
+
+		select {
+		case got := <-routes:
+			if got != route {
+				t.Errorf("Expected %+v, got %+v", route, got)
+			}
+		case <-time.After(testTimeout):
+			t.Fatalf("Timed out waiting for the request to protocol %X", route.protocolID)
+		}
+	}
+}
+
+func TestServerRespondsToUnhandledRMC(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetAutoRespondUnhandled(true)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	client.sendData(newTestRMCRequest(0x0B, 7, 3, nil))
+
+	response := client.receive()
+
+	if response.Type() != DataPacket {
+		t.Fatalf("Expected a DATA packet, got type %d", response.Type())
+	}
+
+	stream := NewStreamIn(response.deciphered, nil)
+	body, err := stream.ReadBuffer()
+
+	if err != nil || len(body) != 10 {
+		t.Fatalf("Expected a 10 byte RMC error response, got % X (error %v)", response.deciphered, err)
+	}
+
+	bodyStream := NewStreamIn(body, nil)
+
+	protocolID := bodyStream.ReadUInt8()
+	success := bodyStream.ReadUInt8()
+	errorCode := bodyStream.ReadUInt32LE()
+	callID := bodyStream.ReadUInt32LE()
+
+	if protocolID != 0x0B || success != 0 || errorCode != uint32(QErrorCoreNotImplemented) || callID != 7 {
+		t.Errorf("Unexpected RMC error response: protocol %X success %d error %X call %d", protocolID, success, errorCode, callID)
+	}
+
+	// A message without the request bit is a response from the client, which is never answered
+	message := newTestRMCRequest(0x0B, 8, 3, nil)
+	message[4] &^= 0x80
+
+	client.sendData(message)
+	client.expectNothing(100 * time.Millisecond)
+}
+
+func TestServerDropsUnauthenticatedData(t *testing.T) {
+	dropped := make(chan string, 4)
+	received := make(chan struct{}, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.SetIsSecureServer(true)
+
+		server.OnPacketDropped(func(address *net.UDPAddr, reason string) {
+			dropped <- reason
+		})
+
+		server.On("Data", func(packet PacketInterface) {
+			received <- struct{}{}
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.syn()
+
+	// DATA sent without a CONNECT, so the server has no session key for the client
+	client.sequenceID = 1
+	client.sendData(newTestRMCRequest(0x0A, 1, 1, nil))
+
+	select {
+	case reason := <-dropped:
+		if reason != "DATA packet from unauthenticated client" {
+			t.Errorf("Unexpected drop reason %q", reason)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the DATA packet to be dropped")
+	}
+
+	client.expectNothing(100 * time.Millisecond)
+
+	select {
+	case <-received:
+		t.Error("DATA from an unauthenticated client reached the handlers")
+	default:
+	}
+}
+
+func TestServerConnectionSignatureAlgorithms(t *testing.T) {
+	v0Server := NewServer()
+	v0Server.SetPrudpVersion(0)
+
+	v0Client := NewClient(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60000}, v0Server)
+
+	if signature := v0Server.connectionSignature(v0Client); !bytes.Equal(signature, make([]byte, 4)) {
+		t.Errorf("Expected a PRUDPv0 connection signature of 4 zero bytes, got % X", signature)
+	}
+
+	v1Server := NewServer()
+	v1Client := NewClient(&net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 60000}, v1Server)
+
+	first := v1Server.connectionSignature(v1Client)
+	second := v1Server.connectionSignature(v1Client)
+
+	if len(first) != 16 || len(second) != 16 || bytes.Equal(first, second) {
+		t.Errorf("Expected distinct random 16 byte PRUDPv1 connection signatures, got % X and % X", first, second)
+	}
+
+	custom := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F, 0x10}
+
+	server := newTestServer(t, func(server *Server) {
+		server.SetConnectionSignatureFunction(func(client *Client) []byte {
+			return custom
+		})
+	})
+
+	client := newTestClient(t, server)
+	synAck := client.syn()
+
+	if !bytes.Equal(synAck.ConnectionSignature(), custom) {
+		t.Errorf("Expected the custom connection signature in the SYN acknowledgement, got % X", synAck.ConnectionSignature())
+	}
+
+	// Setting nil restores the default algorithm
+	v1Server.SetConnectionSignatureFunction(func(client *Client) []byte { return custom })
+	v1Server.SetConnectionSignatureFunction(nil)
+
+	if signature := v1Server.connectionSignature(v1Client); bytes.Equal(signature, custom) || len(signature) != 16 {
+		t.Errorf("Expected the default connection signature after resetting, got % X", signature)
+	}
+}
+
+func TestServerPayloadTransform(t *testing.T) {
+	prefix := []byte{'E', 'N', 'V', 0x01}
+
+	requests := make(chan RMCRequest, 1)
+	dropped := make(chan string, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.SetAutoRespondUnhandled(true)
+
+		server.SetPayloadTransform(func(payload []byte) ([]byte, error) {
+			if !bytes.HasPrefix(payload, prefix) {
+				return nil, errors.New("missing envelope")
+			}
+
+			return payload[len(prefix):], nil
+		}, func(payload []byte) ([]byte, error) {
+			return append(append([]byte{}, prefix...), payload...), nil
+		})
+
+		server.OnRMC(0x0A, func(packet PacketInterface) {
+			requests <- packet.RMCRequest()
+		})
+
+		server.OnPacketDropped(func(address *net.UDPAddr, reason string) {
+			dropped <- reason
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	parameters := []byte{0x01, 0x02, 0x03}
+	client.sendData(append(append([]byte{}, prefix...), newTestRMCRequest(0x0A, 1, 2, parameters)...))
+
+	select {
+	case request := <-requests:
+		if request.ProtocolID() != 0x0A || request.CallID() != 1 || request.MethodID() != 2 || !bytes.Equal(request.Parameters(), parameters) {
+			t.Errorf("Unexpected RMC request: protocol %X call %d method %d parameters % X",
+				request.ProtocolID(), request.CallID(), request.MethodID(), request.Parameters())
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the RMC request")
+	}
+
+	// The error response to an unhandled request goes through the outbound transform
+	client.sendData(append(append([]byte{}, prefix...), newTestRMCRequest(0x0B, 2, 1, nil)...))
+
+	response := client.receive()
+
+	if !bytes.HasPrefix(response.deciphered, prefix) {
+		t.Fatalf("Expected the response to start with the envelope, got % X", response.deciphered)
+	}
+
+	body, err := NewStreamIn(response.deciphered[len(prefix):], nil).ReadBuffer()
+
+	if err != nil || len(body) != 10 || body[0] != 0x0B {
+		t.Errorf("Expected an RMC error response to protocol 0x0B after the envelope, got % X (error %v)", response.deciphered, err)
+	}
+
+	client.sendData(newTestRMCRequest(0x0A, 3, 2, parameters))
+
+	select {
+	case reason := <-dropped:
+		if !strings.Contains(reason, "missing envelope") {
+			t.Errorf("Unexpected drop reason %q", reason)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the payload without an envelope to be dropped")
+	}
+}
+
+func TestServerAcknowledgesNonSecureConnect(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	client := newTestClient(t, server)
+	synAck := client.syn()
+
+	clientSignature := make([]byte, 16)
+	rand.Read(clientSignature)
+
+	client.peer.SetClientConnectionSignature(synAck.ConnectionSignature())
+	client.peer.SetServerConnectionSignature(clientSignature)
+
+	connect := client.newPacket(ConnectPacket, FlagReliable|FlagNeedsAck)
+	connect.SetSequenceID(1)
+	connect.SetSupportedFunctions(0x04)
+	connect.SetConnectionSignature(clientSignature)
+	client.sendPacket(connect)
+
+	connectAck := client.receive()
+
+	if connectAck.Type() != ConnectPacket || connectAck.Flags() != FlagAck|FlagHasSize {
+		t.Errorf("Expected a CONNECT acknowledgement with flags %X, got type %d flags %X", FlagAck|FlagHasSize, connectAck.Type(), connectAck.Flags())
+	}
+
+	if connectAck.Source() != 0xA1 || connectAck.Destination() != 0xAF {
+		t.Errorf("Expected source A1 and destination AF, got %X and %X", connectAck.Source(), connectAck.Destination())
+	}
+
+	// The sequence and session IDs of the CONNECT are echoed back
+	if connectAck.SequenceID() != 1 || connectAck.SessionID() != client.sessionID {
+		t.Errorf("Expected sequence ID 1 and session ID %d, got %d and %d", client.sessionID, connectAck.SequenceID(), connectAck.SessionID())
+	}
+
+	if !bytes.Equal(connectAck.ConnectionSignature(), make([]byte, 16)) {
+		t.Errorf("Expected an empty connection signature, got % X", connectAck.ConnectionSignature())
+	}
+
+	if connectAck.SupportedFunctions() != 0x04 || connectAck.InitialSequenceID() != 10000 || connectAck.MaximumSubstreamID() != 0 {
+		t.Errorf("Unexpected options: supported functions %X initial sequence ID %d maximum substream ID %d",
+			connectAck.SupportedFunctions(), connectAck.InitialSequenceID(), connectAck.MaximumSubstreamID())
+	}
+
+	if len(connectAck.Payload()) != 0 {
+		t.Errorf("Expected no payload on a non-secure server, got % X", connectAck.Payload())
+	}
+}
+
+func TestServerListenAsyncPortInUse(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	second := NewServer()
+	ready, errc := second.ListenAsync(server.Socket().LocalAddr().String())
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			t.Error("Expected an error binding to a port which is in use")
+		}
+	case <-ready:
+		second.Shutdown()
+		t.Fatal("Bound to a port which is in use")
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the bind error")
+	}
+}
+
+func TestServerListenInvalidPort(t *testing.T) {
+	server := NewServer()
+
+	if err := server.Listen("127.0.0.1:70000"); err == nil {
+		t.Error("Expected an error listening on an invalid port")
+	}
+}
+
+func TestServerRotateAccessKey(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	server.RotateAccessKey("6f599f81")
+
+	if server.AccessKey() != "6f599f81" {
+		t.Errorf("Expected access key 6f599f81, got %q", server.AccessKey())
+	}
+
+	// Clients signed with the old key are disconnected
+	if server.ClientConnected(client.client) || len(server.Clients()) != 0 {
+		t.Error("Client connected with the old access key is still connected")
+	}
+
+	reconnected := newTestClient(t, server)
+	reconnected.connect(nil)
+
+	if !server.ClientConnected(reconnected.client) {
+		t.Error("Client using the new access key failed to connect")
+	}
+}
+
+func TestServerDropsMismatchedSessionID(t *testing.T) {
+	dropped := make(chan string, 1)
+	requests := make(chan RMCRequest, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.OnPacketDropped(func(address *net.UDPAddr, reason string) {
+			dropped <- reason
+		})
+
+		server.OnRMC(0x0A, func(packet PacketInterface) {
+			requests <- packet.RMCRequest()
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	client.sessionID++
+	client.sendData(newTestRMCRequest(0x0A, 1, 1, nil))
+
+	select {
+	case reason := <-dropped:
+		if reason != "Mismatched session ID" {
+			t.Errorf("Unexpected drop reason %q", reason)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the packet with the wrong session ID to be dropped")
+	}
+
+	select {
+	case <-requests:
+		t.Error("Packet with the wrong session ID reached the handlers")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestServerClientByPID(t *testing.T) {
+	// A PID above 32 bits, as used by NEX 4 titles
+	pid := NewPID(0x100000002)
+
+	server := newTestServer(t, func(server *Server) {
+		server.SetIsSecureServer(true)
+
+		server.On("Connect", func(packet PacketInterface) {
+			packet.Sender().SetSessionKey(testSessionKey)
+			packet.Sender().SetPID(pid)
+			server.AcknowledgePacket(packet, []byte{0x04, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00})
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.authenticate()
+
+	found, ok := server.ClientByPID(NewPID(0x100000002))
+
+	if !ok || found != client.client {
+		t.Fatal("Authenticated client was not found by its PID")
+	}
+
+	// Only the full 64 bits match
+	if _, ok := server.ClientByPID(NewPID(2)); ok {
+		t.Error("Client was found by the lower 32 bits of its PID")
+	}
+
+	server.Kick(client.client)
+
+	if _, ok := server.ClientByPID(pid); ok {
+		t.Error("Kicked client was still found by its PID")
+	}
+}
+
+func TestServerReconnect(t *testing.T) {
+	reconnects := make(chan *Client, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.SetReconnectionWindow(time.Minute)
+
+		server.OnReconnect(func(client *Client) {
+			reconnects <- client
+		})
+	})
+
+	pid := NewPID(1234)
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+	client.client.SetPID(pid)
+	client.client.SetUserData("session")
+
+	server.Kick(client.client)
+
+	// A different PID is not a reconnection
+	other := newTestClient(t, server)
+	other.connect(nil)
+	other.client.SetPID(NewPID(5678))
+
+	if other.client.UserData() != nil {
+		t.Errorf("Expected a client with a different PID to have no user data, got %v", other.client.UserData())
+	}
+
+	reconnected := newTestClient(t, server)
+	reconnected.connect(nil)
+	reconnected.client.SetPID(pid)
+
+	select {
+	case client := <-reconnects:
+		if client != reconnected.client {
+			t.Error("OnReconnect was run with the wrong client")
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for OnReconnect")
+	}
+
+	if reconnected.client.UserData() != "session" {
+		t.Errorf("Expected the user data to be restored, got %v", reconnected.client.UserData())
+	}
+
+	if found, ok := server.ClientByPID(pid); !ok || found != reconnected.client {
+		t.Error("Expected the PID to be associated with the reconnected client")
+	}
+}
+
+func TestServerClientByConnectionID(t *testing.T) {
+	disconnected := make(chan struct{}, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.On("Disconnect", func(packet PacketInterface) {
+			disconnected <- struct{}{}
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	connectionID := client.client.ConnectionID()
+
+	found, ok := server.ClientByConnectionID(connectionID)
+
+	if !ok || found != client.client {
+		t.Fatalf("Connected client was not found by its connection ID %d", connectionID)
+	}
+
+	client.sequenceID++
+
+	disconnect := client.newPacket(DisconnectPacket, FlagReliable|FlagNeedsAck)
+	disconnect.SetSequenceID(client.sequenceID)
+	client.sendPacket(disconnect)
+
+	select {
+	case <-disconnected:
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the client to disconnect")
+	}
+
+	if _, ok := server.ClientByConnectionID(connectionID); ok {
+		t.Error("Disconnected client was still found by its connection ID")
+	}
+}
+
+func TestDefaultClientDiscriminatorIPv6Zones(t *testing.T) {
+	ip := net.ParseIP("fe80::1")
+
+	withZone := defaultClientDiscriminator(&net.UDPAddr{IP: ip, Port: 60000, Zone: "eth0"}, nil)
+	withOtherZone := defaultClientDiscriminator(&net.UDPAddr{IP: ip, Port: 60000, Zone: "2"}, nil)
+	withoutZone := defaultClientDiscriminator(&net.UDPAddr{IP: ip, Port: 60000}, nil)
+
+	if withZone != withoutZone || withOtherZone != withoutZone {
+		t.Errorf("Expected the same key regardless of zone, got %q, %q and %q", withZone, withOtherZone, withoutZone)
+	}
+
+	if withoutZone != "[fe80::1]:60000" {
+		t.Errorf("Expected key [fe80::1]:60000, got %q", withoutZone)
+	}
+
+	if key := defaultClientDiscriminator(&net.UDPAddr{IP: ip, Port: 60001, Zone: "eth0"}, nil); key == withZone {
+		t.Error("Different ports gave the same key")
+	}
+
+	mapped := defaultClientDiscriminator(&net.UDPAddr{IP: net.ParseIP("::ffff:192.168.1.20"), Port: 60000}, nil)
+	plain := defaultClientDiscriminator(&net.UDPAddr{IP: net.IPv4(192, 168, 1, 20).To4(), Port: 60000}, nil)
+
+	if mapped != plain || plain != "192.168.1.20:60000" {
+		t.Errorf("Expected IPv4-mapped and plain IPv4 addresses to give 192.168.1.20:60000, got %q and %q", mapped, plain)
+	}
+}
+
+func TestServerConcurrentFragmentedSends(t *testing.T) {
+	server := newTestServer(t, func(server *Server) {
+		server.SetFragmentSize(16)
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	payloads := [][]byte{bytes.Repeat([]byte{0xAA}, 100), bytes.Repeat([]byte{0xBB}, 100)}
+
+	// Sent from separate goroutines, as handlers would
+	for _, payload := range payloads {
+		go func(payload []byte) {
+			packet, _ := NewPacketV1(client.client, nil)
+			packet.SetSource(0xA1)
+			packet.SetDestination(0xAF)
+			packet.SetType(DataPacket)
+			packet.SetPayload(payload)
+			packet.AddFlag(FlagNeedsAck)
+			packet.AddFlag(FlagReliable)
+
+			server.Send(packet)
+		}(payload)
+	}
+
+	var received [][]byte
+	var message []byte
+
+	for len(received) < len(payloads) {
+		fragment := client.receive()
+
+		message = append(message, fragment.deciphered...)
+
+		if fragment.FragmentID() == 0 {
+			received = append(received, message)
+			message = nil
+		}
+	}
+
+	for _, message := range received {
+		if !bytes.Equal(message, payloads[0]) && !bytes.Equal(message, payloads[1]) {
+			t.Errorf("Fragments of the messages were interleaved, reassembled % X", message)
+		}
+	}
+
+	if bytes.Equal(received[0], received[1]) {
+		t.Error("The same message was reassembled twice")
+	}
+}
+
+func TestServerPacketDataMatchesDatagram(t *testing.T) {
+	received := make(chan []byte, 1)
+
+	server := newTestServer(t, func(server *Server) {
+		server.On("Data", func(packet PacketInterface) {
+			received <- packet.Data()
+		})
+	})
+
+	client := newTestClient(t, server)
+	client.connect(nil)
+
+	datagram := client.newDataPacket(newTestRMCRequest(0x0A, 1, 1, []byte{0x01, 0x02}), 0).Bytes()
+
+	if _, err := client.conn.Write(datagram); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	select {
+	case data := <-received:
+		if !bytes.Equal(data, datagram) {
+			t.Errorf("Packet data does not match the datagram\nexpected: % X\ngot:      % X", datagram, data)
+		}
+	case <-time.After(testTimeout):
+		t.Fatal("Timed out waiting for the DATA packet")
+	}
+}
@@ -0,0 +1,36 @@
+package nex
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInsufficientData is the error wrapped by a StreamError when a stream does not have enough data left for a read
+var ErrInsufficientData = errors.New("not enough data")
+
+// ErrLengthExceedsLimit is the error wrapped by a StreamError when a declared length is greater than the limit given to a reader
+var ErrLengthExceedsLimit = errors.New("length exceeds limit")
+
+// StreamError is returned by the StreamIn readers when a read fails. Use errors.Is to check the underlying error.
+// Expected is the number of bytes needed, or the declared length when a limit is exceeded
+type StreamError struct {
+	Op        string
+	Expected  int64
+	Remaining int64
+	Limit     int64
+	Err       error
+}
+
+// Error returns the error message
+func (err *StreamError) Error() string {
+	if err.Err == ErrLengthExceedsLimit {
+		return fmt.Sprintf("[StreamIn] %s: %s (declared %d, limit %d)", err.Op, err.Err, err.Expected, err.Limit)
+	}
+
+	return fmt.Sprintf("[StreamIn] %s: %s (expected %d bytes, %d remaining)", err.Op, err.Err, err.Expected, err.Remaining)
+}
+
+// Unwrap returns the underlying error
+func (err *StreamError) Unwrap() error {
+	return err.Err
+}
@@ -2,6 +2,8 @@ package nex
 
 import (
 	"errors"
+	"fmt"
+	"math"
 	"strings"
 
 	crunch "github.com/superwhiskers/crunch/v3"
@@ -23,6 +25,48 @@ func (stream *StreamIn) ReadUInt16LE() uint16 {
 	return stream.ReadU16LENext(1)[0]
 }
 
+// ReadUInt24LE reads a 24 bit little endian unsigned integer
+func (stream *StreamIn) ReadUInt24LE() (uint32, error) {
+	err := stream.checkRemaining("ReadUInt24LE", 3)
+
+	if err != nil {
+		return 0, err
+	}
+
+	data := stream.ReadBytesNext(3)
+
+	return uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16, nil
+}
+
+// ReadUInt24BE reads a 24 bit big endian unsigned integer
+func (stream *StreamIn) ReadUInt24BE() (uint32, error) {
+	err := stream.checkRemaining("ReadUInt24BE", 3)
+
+	if err != nil {
+		return 0, err
+	}
+
+	data := stream.ReadBytesNext(3)
+
+	return uint32(data[0])<<16 | uint32(data[1])<<8 | uint32(data[2]), nil
+}
+
+// ReadInt24LE reads a 24 bit little endian signed integer
+func (stream *StreamIn) ReadInt24LE() (int32, error) {
+	value, err := stream.ReadUInt24LE()
+
+	// Shift the sign bit into place to sign extend the value
+	return int32(value<<8) >> 8, err
+}
+
+// ReadInt24BE reads a 24 bit big endian signed integer
+func (stream *StreamIn) ReadInt24BE() (int32, error) {
+	value, err := stream.ReadUInt24BE()
+
+	// Shift the sign bit into place to sign extend the value
+	return int32(value<<8) >> 8, err
+}
+
 // ReadUInt32LE reads a uint32
 func (stream *StreamIn) ReadUInt32LE() uint32 {
 	return stream.ReadU32LENext(1)[0]
@@ -33,43 +77,265 @@ func (stream *StreamIn) ReadUInt64LE() uint64 {
 	return stream.ReadU64LENext(1)[0]
 }
 
-// ReadString reads and returns a nex string type
+// ReadFloat32LE reads a little endian float32. The value is converted from its bits so NaN payloads are preserved
+func (stream *StreamIn) ReadFloat32LE() float32 {
+	return math.Float32frombits(stream.ReadU32LENext(1)[0])
+}
+
+// ReadFloat32BE reads a big endian float32. The value is converted from its bits so NaN payloads are preserved
+func (stream *StreamIn) ReadFloat32BE() float32 {
+	return math.Float32frombits(stream.ReadU32BENext(1)[0])
+}
+
+// ReadFloat64LE reads a little endian float64. The value is converted from its bits so NaN payloads are preserved
+func (stream *StreamIn) ReadFloat64LE() float64 {
+	return math.Float64frombits(stream.ReadU64LENext(1)[0])
+}
+
+// ReadFloat64BE reads a big endian float64. The value is converted from its bits so NaN payloads are preserved
+func (stream *StreamIn) ReadFloat64BE() float64 {
+	return math.Float64frombits(stream.ReadU64BENext(1)[0])
+}
+
+// ReadBool reads a bool. Only a byte value of 1 is read as true, any other value is read as false
+func (stream *StreamIn) ReadBool() bool {
+	return stream.ReadUInt8() == 1
+}
+
+// ReadString reads and returns a nex string type.
+// Trailing null characters are trimmed, so a string made up only of nulls is read as an empty string. Use ReadStringRaw to keep them
 func (stream *StreamIn) ReadString() (string, error) {
-	length := stream.ReadUInt16LE()
+	str, err := stream.ReadStringRaw()
 
-	if len(stream.Bytes()[stream.ByteOffset():]) < int(length) {
-		return "", errors.New("[StreamIn] Nex string length longer than data size")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(str, "\x00"), nil
+}
+
+// ReadStringMax reads and returns a nex string type like ReadString, but returns an error before reading any data if its length is greater than limit
+func (stream *StreamIn) ReadStringMax(limit int) (string, error) {
+	length, err := stream.readLength16("ReadStringMax")
+
+	if err != nil {
+		return "", err
+	}
+
+	err = stream.checkLimit("ReadStringMax", int64(length), int64(limit))
+
+	if err != nil {
+		return "", err
+	}
+
+	err = stream.checkRemaining("ReadStringMax", int64(length))
+
+	if err != nil {
+		return "", err
 	}
 
 	stringData := stream.ReadBytesNext(int64(length))
-	str := string(stringData)
 
-	return strings.TrimRight(str, "\x00"), nil
+	return strings.TrimRight(string(stringData), "\x00"), nil
 }
 
-// ReadBuffer reads a nex Buffer type
+// ReadStringRaw reads and returns a nex string type without trimming the null terminator
+func (stream *StreamIn) ReadStringRaw() (string, error) {
+	length, err := stream.readLength16("ReadString")
+
+	if err != nil {
+		return "", err
+	}
+
+	err = stream.checkRemaining("ReadString", int64(length))
+
+	if err != nil {
+		return "", err
+	}
+
+	stringData := stream.ReadBytesNext(int64(length))
+
+	return string(stringData), nil
+}
+
+// ReadStringFixed reads a string stored as exactly size bytes with no length prefix, trimming the trailing null padding
+func (stream *StreamIn) ReadStringFixed(size int) (string, error) {
+	err := stream.checkRemaining("ReadStringFixed", int64(size))
+
+	if err != nil {
+		return "", err
+	}
+
+	stringData := stream.ReadBytesNext(int64(size))
+
+	return strings.TrimRight(string(stringData), "\x00"), nil
+}
+
+// ReadStationURL reads a StationURL, which is encoded as a nex string type
+func (stream *StreamIn) ReadStationURL() (*StationURL, error) {
+	str, err := stream.ReadString()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStationURL(str), nil
+}
+
+// ReadDateTime reads a DateTime type
+func (stream *StreamIn) ReadDateTime() *DateTime {
+	return NewDateTime(stream.ReadUInt64LE())
+}
+
+// ReadPID reads a NEX PID type. PIDs are read as 64-bit values if Uses64BitPIDs reports so for the stream server, and 32-bit values otherwise
+func (stream *StreamIn) ReadPID() *PID {
+	if Uses64BitPIDs(stream.Server) {
+		return NewPID(stream.ReadUInt64LE())
+	}
+
+	return NewLegacyPID(stream.ReadUInt32LE())
+}
+
+// ReadBuffer reads a nex Buffer type. An empty buffer is returned as a non-nil empty slice, and nil is returned on error
 func (stream *StreamIn) ReadBuffer() ([]byte, error) {
-	length := stream.ReadUInt32LE()
+	length, err := stream.readLength32("ReadBuffer")
 
-	if len(stream.Bytes()[stream.ByteOffset():]) < int(length) {
-		return []byte{}, errors.New("[StreamIn] Nex buffer length longer than data size")
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadBuffer", int64(length))
+
+	if err != nil {
+		return nil, err
 	}
 
 	data := stream.ReadBytesNext(int64(length))
 
+	if data == nil {
+		data = []byte{}
+	}
+
 	return data, nil
 }
 
-// ReadQBuffer reads a nex qBuffer type
+// ReadQBuffer reads a nex qBuffer type, which is a buffer with a uint16 length. An empty buffer is returned as a non-nil empty slice, and nil is returned on error
 func (stream *StreamIn) ReadQBuffer() ([]byte, error) {
-	length := stream.ReadUInt16LE()
+	length, err := stream.readLength16("ReadQBuffer")
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadQBuffer", int64(length))
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := stream.ReadBytesNext(int64(length))
+
+	if data == nil {
+		data = []byte{}
+	}
+
+	return data, nil
+}
+
+// ReadBufferMax reads a nex Buffer type like ReadBuffer, but returns an error before reading any data if its length is greater than limit
+func (stream *StreamIn) ReadBufferMax(limit int) ([]byte, error) {
+	length, err := stream.readLength32("ReadBufferMax")
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkLimit("ReadBufferMax", int64(length), int64(limit))
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadBufferMax", int64(length))
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := stream.ReadBytesNext(int64(length))
+
+	if data == nil {
+		data = []byte{}
+	}
+
+	return data, nil
+}
+
+// ReadQBufferMax reads a nex qBuffer type like ReadQBuffer, but returns an error before reading any data if its length is greater than limit
+func (stream *StreamIn) ReadQBufferMax(limit int) ([]byte, error) {
+	length, err := stream.readLength16("ReadQBufferMax")
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkLimit("ReadQBufferMax", int64(length), int64(limit))
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadQBufferMax", int64(length))
 
-	if len(stream.Bytes()[stream.ByteOffset():]) < int(length) {
-		return []byte{}, errors.New("[StreamIn] Nex qBuffer length longer than data size")
+	if err != nil {
+		return nil, err
 	}
 
 	data := stream.ReadBytesNext(int64(length))
 
+	if data == nil {
+		data = []byte{}
+	}
+
+	return data, nil
+}
+
+// ReadBufferSized reads a buffer with a length of lengthSize bytes, which must be 1, 2 or 4.
+// This covers the protocols which use a Buffer with a smaller length than the standard Buffer and qBuffer types
+func (stream *StreamIn) ReadBufferSized(lengthSize int) ([]byte, error) {
+	var length uint32
+
+	if lengthSize != 1 && lengthSize != 2 && lengthSize != 4 {
+		return nil, fmt.Errorf("[StreamIn] Invalid buffer length size %d", lengthSize)
+	}
+
+	err := stream.checkRemaining("ReadBufferSized", int64(lengthSize))
+
+	if err != nil {
+		return nil, err
+	}
+
+	switch lengthSize {
+	case 1:
+		length = uint32(stream.ReadUInt8())
+	case 2:
+		length = uint32(stream.ReadUInt16LE())
+	case 4:
+		length = stream.ReadUInt32LE()
+	}
+
+	err = stream.checkRemaining("ReadBufferSized", int64(length))
+
+	if err != nil {
+		return nil, err
+	}
+
+	data := stream.ReadBytesNext(int64(length))
+
+	if data == nil {
+		data = []byte{}
+	}
+
 	return data, nil
 }
 
@@ -81,46 +347,69 @@ func (stream *StreamIn) ReadStructure(structure StructureInterface) (StructureIn
 		_, err := stream.ReadStructure(class)
 
 		if err != nil {
-			return structure, errors.New("[ReadStructure] " + err.Error())
+			return structure, fmt.Errorf("[ReadStructure] %w", err)
 		}
 	}
 
-	if stream.Server.NexVersion() >= 3 {
-		// skip the new struct header as we don't really need the data there
-		_ = stream.ReadUInt8()    // structure header version
-		_ = stream.ReadUInt32LE() // structure content length
+	if UsesStructureHeader(stream.Server) {
+		err := stream.checkRemaining("ReadStructure", 5)
+
+		if err != nil {
+			return structure, fmt.Errorf("[ReadStructure] %w", err)
+		}
+
+		version := stream.ReadUInt8() // structure header version
+		_ = stream.ReadUInt32LE()     // structure content length
+
+		if versioned, ok := structure.(VersionedStructure); ok && !supportsStructureVersion(versioned, version) {
+			return structure, fmt.Errorf("[ReadStructure] Unsupported structure version %d", version)
+		}
 	}
 
 	err := structure.ExtractFromStream(stream)
 
 	if err != nil {
-		return structure, errors.New("[ReadStructure] " + err.Error())
+		return structure, fmt.Errorf("[ReadStructure] %w", err)
 	}
 
 	return structure, nil
 }
 
-// ReadVariant reads a Variant type. This type can hold 7 different types
-func (stream *StreamIn) ReadVariant() interface{} {
-	switch stream.ReadUInt8() {
-	case 0: // null
-		return nil
-	case 1: // sint64
-		return int64(stream.ReadUInt64LE())
-	case 2: // double
-		return float64(stream.ReadUInt64LE())
-	case 3: // bool
-		return stream.ReadUInt8() == 1
-	case 4: // string
-		str, _ := stream.ReadString()
-		return str
-	case 5: // datetime
-		return NewDateTime(stream.ReadUInt64LE())
-	case 6: // uint64
-		return stream.ReadUInt64LE()
+func supportsStructureVersion(structure VersionedStructure, version uint8) bool {
+	for _, supportedVersion := range structure.SupportedVersions() {
+		if supportedVersion == version {
+			return true
+		}
 	}
 
-	return nil
+	return false
+}
+
+// ReadStructureWithSize reads a nex Structure type like ReadStructure, also returning the number of bytes it took up in the stream
+func (stream *StreamIn) ReadStructureWithSize(structure StructureInterface) (StructureInterface, int, error) {
+	start := stream.ByteOffset()
+
+	structure, err := stream.ReadStructure(structure)
+
+	return structure, int(stream.ByteOffset() - start), err
+}
+
+// ReadVariant reads a Variant type. The standard 7 type IDs are supported, along with any registered with RegisterVariantType.
+// An error is returned for unknown type IDs
+func (stream *StreamIn) ReadVariant() (interface{}, error) {
+	err := stream.checkRemaining("ReadVariant", 1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	variant, err := lookupVariantType(stream.ReadUInt8())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return variant.reader(stream)
 }
 
 // ReadMap reads a Map type with the given key and value types
@@ -133,7 +422,12 @@ func (stream *StreamIn) ReadMap(keyFunction interface{}, valueFunction interface
 		At the moment this just reads what type you want from the interface{} function type
 	*/
 
-	length := stream.ReadUInt32LE()
+	length, err := stream.readLength32("ReadMap")
+
+	if err != nil {
+		return nil, err
+	}
+
 	newMap := make(map[interface{}]interface{})
 
 	for i := 0; i < int(length); i++ {
@@ -141,18 +435,23 @@ func (stream *StreamIn) ReadMap(keyFunction interface{}, valueFunction interface
 		var value interface{}
 		var err error
 
-		switch keyFunction.(type) {
-		case func() (string, error):
-			key, err = stream.ReadString()
-		}
+		key, err = stream.readMapKey(keyFunction)
 
 		if err != nil {
 			return nil, err
 		}
 
-		switch valueFunction.(type) {
+		switch valueFunction := valueFunction.(type) {
+		case func() (interface{}, error):
+			value, err = valueFunction()
 		case func() interface{}:
-			value = stream.ReadVariant()
+			value = valueFunction()
+		default:
+			return nil, errors.New("[StreamIn] Unsupported Map value type")
+		}
+
+		if err != nil {
+			return nil, err
 		}
 
 		newMap[key] = value
@@ -161,9 +460,90 @@ func (stream *StreamIn) ReadMap(keyFunction interface{}, valueFunction interface
 	return newMap, nil
 }
 
+// ReadMapStructure reads a Map type with the given key type and Structure values. newStructure is called to create each value before it is read
+func (stream *StreamIn) ReadMapStructure(keyFunction interface{}, newStructure func() StructureInterface) (map[interface{}]StructureInterface, error) {
+	length, err := stream.readLength32("ReadMapStructure")
+
+	if err != nil {
+		return nil, err
+	}
+
+	newMap := make(map[interface{}]StructureInterface)
+
+	for i := 0; i < int(length); i++ {
+		key, err := stream.readMapKey(keyFunction)
+
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := stream.ReadStructure(newStructure())
+
+		if err != nil {
+			return nil, err
+		}
+
+		newMap[key] = value
+	}
+
+	return newMap, nil
+}
+
+// readMapKey reads a single Map key using the given stream function
+func (stream *StreamIn) readMapKey(keyFunction interface{}) (interface{}, error) {
+	switch keyFunction := keyFunction.(type) {
+	case func() (string, error):
+		return keyFunction()
+	case func() uint8:
+		return keyFunction(), nil
+	case func() uint16:
+		return keyFunction(), nil
+	case func() uint32:
+		return keyFunction(), nil
+	case func() uint64:
+		return keyFunction(), nil
+	}
+
+	return nil, errors.New("[StreamIn] Unsupported Map key type")
+}
+
+// ReadListStructure reads a list of Structure types. newStructure is called to create each element before it is read
+func (stream *StreamIn) ReadListStructure(newStructure func() StructureInterface) ([]StructureInterface, error) {
+	length, err := stream.readLength32("ReadListStructure")
+
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]StructureInterface, 0)
+
+	for i := 0; i < int(length); i++ {
+		structure, err := stream.ReadStructure(newStructure())
+
+		if err != nil {
+			return nil, err
+		}
+
+		list = append(list, structure)
+	}
+
+	return list, nil
+}
+
 // ReadListUInt8 reads a list of uint8 types
-func (stream *StreamIn) ReadListUInt8() []uint8 {
-	length := stream.ReadUInt32LE()
+func (stream *StreamIn) ReadListUInt8() ([]uint8, error) {
+	length, err := stream.readLength32("ReadListUInt8")
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadListUInt8", int64(length))
+
+	if err != nil {
+		return nil, err
+	}
+
 	list := make([]uint8, 0, length)
 
 	for i := 0; i < int(length); i++ {
@@ -171,12 +551,48 @@ func (stream *StreamIn) ReadListUInt8() []uint8 {
 		list = append(list, value)
 	}
 
-	return list
+	return list, nil
+}
+
+// ReadListBool reads a list of bool types. Any non-zero byte is read as true
+func (stream *StreamIn) ReadListBool() ([]bool, error) {
+	length, err := stream.readLength32("ReadListBool")
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadListBool", int64(length))
+
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]bool, 0, length)
+
+	for i := 0; i < int(length); i++ {
+		value := stream.ReadUInt8() != 0
+		list = append(list, value)
+	}
+
+	return list, nil
 }
 
 // ReadListUInt16LE reads a list of uint16 types
-func (stream *StreamIn) ReadListUInt16LE() []uint16 {
-	length := stream.ReadUInt32LE()
+func (stream *StreamIn) ReadListUInt16LE() ([]uint16, error) {
+	length, err := stream.readLength32("ReadListUInt16LE")
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Computed in 64 bits so a large length can't overflow the check on 32-bit platforms
+	err = stream.checkRemaining("ReadListUInt16LE", int64(length)*2)
+
+	if err != nil {
+		return nil, err
+	}
+
 	list := make([]uint16, 0, length)
 
 	for i := 0; i < int(length); i++ {
@@ -184,12 +600,71 @@ func (stream *StreamIn) ReadListUInt16LE() []uint16 {
 		list = append(list, value)
 	}
 
-	return list
+	return list, nil
+}
+
+// ReadListUInt24LE reads a list of 24 bit little endian unsigned integers
+func (stream *StreamIn) ReadListUInt24LE() ([]uint32, error) {
+	length, err := stream.readLength32("ReadListUInt24LE")
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadListUInt24LE", int64(length)*3)
+
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]uint32, 0, length)
+
+	for i := 0; i < int(length); i++ {
+		value, _ := stream.ReadUInt24LE()
+		list = append(list, value)
+	}
+
+	return list, nil
+}
+
+// ReadListUInt24BE reads a list of 24 bit big endian unsigned integers
+func (stream *StreamIn) ReadListUInt24BE() ([]uint32, error) {
+	length, err := stream.readLength32("ReadListUInt24BE")
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadListUInt24BE", int64(length)*3)
+
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]uint32, 0, length)
+
+	for i := 0; i < int(length); i++ {
+		value, _ := stream.ReadUInt24BE()
+		list = append(list, value)
+	}
+
+	return list, nil
 }
 
 // ReadListUInt32LE reads a list of uint32 types
-func (stream *StreamIn) ReadListUInt32LE() []uint32 {
-	length := stream.ReadUInt32LE()
+func (stream *StreamIn) ReadListUInt32LE() ([]uint32, error) {
+	length, err := stream.readLength32("ReadListUInt32LE")
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadListUInt32LE", int64(length)*4)
+
+	if err != nil {
+		return nil, err
+	}
+
 	list := make([]uint32, 0, length)
 
 	for i := 0; i < int(length); i++ {
@@ -197,12 +672,23 @@ func (stream *StreamIn) ReadListUInt32LE() []uint32 {
 		list = append(list, value)
 	}
 
-	return list
+	return list, nil
 }
 
 // ReadListUInt64LE reads a list of uint64 types
-func (stream *StreamIn) ReadListUInt64LE() []uint64 {
-	length := stream.ReadUInt32LE()
+func (stream *StreamIn) ReadListUInt64LE() ([]uint64, error) {
+	length, err := stream.readLength32("ReadListUInt64LE")
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = stream.checkRemaining("ReadListUInt64LE", int64(length)*8)
+
+	if err != nil {
+		return nil, err
+	}
+
 	list := make([]uint64, 0, length)
 
 	for i := 0; i < int(length); i++ {
@@ -210,7 +696,69 @@ func (stream *StreamIn) ReadListUInt64LE() []uint64 {
 		list = append(list, value)
 	}
 
-	return list
+	return list, nil
+}
+
+// CopyRemaining returns a new stream over the unread bytes of this stream, using the same server
+func (stream *StreamIn) CopyRemaining() *StreamIn {
+	remaining := stream.Bytes()[stream.ByteOffset():]
+	data := make([]byte, len(remaining))
+	copy(data, remaining)
+
+	return NewStreamIn(data, stream.Server)
+}
+
+// readLength16 reads a uint16 length prefix, returning a StreamError instead of panicking if the stream ends first
+func (stream *StreamIn) readLength16(op string) (uint16, error) {
+	err := stream.checkRemaining(op, 2)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return stream.ReadUInt16LE(), nil
+}
+
+// readLength32 reads a uint32 length prefix, returning a StreamError instead of panicking if the stream ends first
+func (stream *StreamIn) readLength32(op string) (uint32, error) {
+	err := stream.checkRemaining(op, 4)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return stream.ReadUInt32LE(), nil
+}
+
+// checkLimit returns a StreamError wrapping ErrLengthExceedsLimit if a declared length is greater than limit
+func (stream *StreamIn) checkLimit(op string, length int64, limit int64) error {
+	if length > limit {
+		return &StreamError{
+			Op:        op,
+			Expected:  length,
+			Remaining: int64(len(stream.Bytes()[stream.ByteOffset():])),
+			Limit:     limit,
+			Err:       ErrLengthExceedsLimit,
+		}
+	}
+
+	return nil
+}
+
+// checkRemaining returns a StreamError wrapping ErrInsufficientData if fewer than expected bytes are left to read
+func (stream *StreamIn) checkRemaining(op string, expected int64) error {
+	remaining := int64(len(stream.Bytes()[stream.ByteOffset():]))
+
+	if remaining < expected {
+		return &StreamError{
+			Op:        op,
+			Expected:  expected,
+			Remaining: remaining,
+			Err:       ErrInsufficientData,
+		}
+	}
+
+	return nil
 }
 
 // NewStreamIn returns a new NEX input stream
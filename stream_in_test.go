@@ -0,0 +1,401 @@
+package nex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestBoolRoundTrip(t *testing.T) {
+	out := NewStreamOut(nil)
+	out.WriteBool(true)
+	out.WriteBool(false)
+
+	in := NewStreamIn(append(out.Bytes(), 0x02, 0xFF), nil)
+
+	if !in.ReadBool() {
+		t.Error("Expected true to round-trip")
+	}
+
+	if in.ReadBool() {
+		t.Error("Expected false to round-trip")
+	}
+
+	// Only 1 is read as true, matching how the rest of the stream handles bools
+	if in.ReadBool() || in.ReadBool() {
+		t.Error("Expected nonzero bytes other than 1 to be read as false")
+	}
+}
+
+func TestReadStringEdgeCases(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+		raw      string
+	}{
+		{"zero length", []byte{0x00, 0x00}, "", ""},
+		{"empty", []byte{0x01, 0x00, 0x00}, "", "\x00"},
+		{"all null", []byte{0x03, 0x00, 0x00, 0x00, 0x00}, "", "\x00\x00\x00"},
+		{"trailing nulls", []byte{0x04, 0x00, 'a', 'b', 0x00, 0x00}, "ab", "ab\x00\x00"},
+		{"no terminator", []byte{0x02, 0x00, 'a', 'b'}, "ab", "ab"},
+	}
+
+	for _, test := range tests {
+		str, err := NewStreamIn(test.data, nil).ReadString()
+
+		if err != nil || str != test.expected {
+			t.Errorf("%s: expected %q, got %q (error %v)", test.name, test.expected, str, err)
+		}
+
+		raw, err := NewStreamIn(test.data, nil).ReadStringRaw()
+
+		if err != nil || raw != test.raw {
+			t.Errorf("%s: expected raw string %q, got %q (error %v)", test.name, test.raw, raw, err)
+		}
+	}
+
+	_, err := NewStreamIn([]byte{0x05, 0x00, 'a'}, nil).ReadString()
+
+	if !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("Expected ErrInsufficientData for a truncated string, got %v", err)
+	}
+}
+
+func TestReadEmptyBuffers(t *testing.T) {
+	buffer, err := NewStreamIn([]byte{0x00, 0x00, 0x00, 0x00}, nil).ReadBuffer()
+
+	if err != nil || buffer == nil || len(buffer) != 0 {
+		t.Errorf("Expected an empty non-nil Buffer, got %#v (error %v)", buffer, err)
+	}
+
+	qBuffer, err := NewStreamIn([]byte{0x00, 0x00}, nil).ReadQBuffer()
+
+	if err != nil || qBuffer == nil || len(qBuffer) != 0 {
+		t.Errorf("Expected an empty non-nil qBuffer, got %#v (error %v)", qBuffer, err)
+	}
+
+	buffer, err = NewStreamIn([]byte{0x02, 0x00, 0x00, 0x00, 0x01}, nil).ReadBuffer()
+
+	if err == nil || buffer != nil {
+		t.Errorf("Expected nil and an error for a truncated Buffer, got %#v (error %v)", buffer, err)
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, str := range []string{"", "Pretendo", "日本語"} {
+		out := NewStreamOut(nil)
+		out.WriteString(str)
+
+		read, err := NewStreamIn(out.Bytes(), nil).ReadString()
+
+		if err != nil || read != str {
+			t.Errorf("Expected %q to round-trip, got %q (error %v)", str, read, err)
+		}
+	}
+
+	out := NewStreamOut(nil)
+	out.WriteString("")
+
+	if !bytes.Equal(out.Bytes(), []byte{0x01, 0x00, 0x00}) {
+		t.Errorf("Expected an empty string to be written as its null terminator, got % X", out.Bytes())
+	}
+}
+
+func TestCopyRemaining(t *testing.T) {
+	server := NewServer()
+	server.SetNexVersion(4)
+
+	data := []byte{0x01, 0x02, 0x03, 0x04, 0x05}
+	stream := NewStreamIn(data, server)
+	stream.ReadUInt16LE()
+
+	remaining := stream.CopyRemaining()
+
+	if remaining.Server != server {
+		t.Error("The sub-stream did not inherit the server")
+	}
+
+	if !bytes.Equal(remaining.Bytes(), []byte{0x03, 0x04, 0x05}) {
+		t.Errorf("Expected the sub-stream to hold the unread bytes, got % X", remaining.Bytes())
+	}
+
+	if remaining.ReadUInt8() != 0x03 {
+		t.Error("The sub-stream did not start at the first unread byte")
+	}
+
+	// Reading the sub-stream does not advance the original
+	if stream.ReadUInt8() != 0x03 {
+		t.Error("Reading the sub-stream advanced the original stream")
+	}
+
+	data[4] = 0xFF
+
+	if remaining.Bytes()[2] != 0x05 {
+		t.Error("The sub-stream shares its data with the original")
+	}
+}
+
+func TestStationURLRoundTrip(t *testing.T) {
+	original := NewStationURL("prudps:/address=192.168.1.20;port=60001;PID=2;sid=15;stream=10;type=2")
+
+	stream := NewStreamOut(nil)
+	stream.WriteStationURL(original)
+
+	decoded, err := NewStreamIn(stream.Bytes(), nil).ReadStationURL()
+
+	if err != nil {
+		t.Fatalf("ReadStationURL failed: %v", err)
+	}
+
+	if decoded.EncodeToString() != original.EncodeToString() {
+		t.Errorf("Expected %q, got %q", original.EncodeToString(), decoded.EncodeToString())
+	}
+
+	if decoded.Address() != "192.168.1.20" || decoded.Port() != "60001" || decoded.PID() != "2" {
+		t.Errorf("Unexpected fields %v", decoded.Fields())
+	}
+}
+
+func TestUInt24RoundTrip(t *testing.T) {
+	out := NewStreamOut(nil)
+	out.WriteUInt24LE(0x123456)
+	out.WriteUInt24BE(0x123456)
+	out.WriteInt24LE(-2)
+	out.WriteInt24BE(-8388608)
+	out.WriteInt24LE(8388607)
+
+	expected := []byte{0x56, 0x34, 0x12, 0x12, 0x34, 0x56, 0xFE, 0xFF, 0xFF, 0x80, 0x00, 0x00, 0xFF, 0xFF, 0x7F}
+
+	if !bytes.Equal(out.Bytes(), expected) {
+		t.Fatalf("Expected % X, got % X", expected, out.Bytes())
+	}
+
+	in := NewStreamIn(out.Bytes(), nil)
+
+	if value, err := in.ReadUInt24LE(); err != nil || value != 0x123456 {
+		t.Errorf("ReadUInt24LE: expected 0x123456, got %X (error %v)", value, err)
+	}
+
+	if value, err := in.ReadUInt24BE(); err != nil || value != 0x123456 {
+		t.Errorf("ReadUInt24BE: expected 0x123456, got %X (error %v)", value, err)
+	}
+
+	if value, err := in.ReadInt24LE(); err != nil || value != -2 {
+		t.Errorf("ReadInt24LE: expected -2, got %d (error %v)", value, err)
+	}
+
+	if value, err := in.ReadInt24BE(); err != nil || value != -8388608 {
+		t.Errorf("ReadInt24BE: expected -8388608, got %d (error %v)", value, err)
+	}
+
+	if value, err := in.ReadInt24LE(); err != nil || value != 8388607 {
+		t.Errorf("ReadInt24LE: expected 8388607, got %d (error %v)", value, err)
+	}
+
+	_, err := NewStreamIn([]byte{0x01, 0x02}, nil).ReadUInt24LE()
+
+	if !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("Expected ErrInsufficientData for a truncated 24 bit integer, got %v", err)
+	}
+}
+
+func TestQBufferRoundTrip(t *testing.T) {
+	for _, data := range [][]byte{{}, {0x01, 0x02, 0x03}, bytes.Repeat([]byte{0xAB}, 0x1234)} {
+		out := NewStreamOut(nil)
+		out.WriteQBuffer(data)
+
+		if len(out.Bytes()) != 2+len(data) {
+			t.Errorf("Expected a %d byte qBuffer, got %d bytes", 2+len(data), len(out.Bytes()))
+		}
+
+		read, err := NewStreamIn(out.Bytes(), nil).ReadQBuffer()
+
+		if err != nil || !bytes.Equal(read, data) {
+			t.Errorf("qBuffer of %d bytes did not round-trip, got %d bytes (error %v)", len(data), len(read), err)
+		}
+	}
+}
+
+func TestListBoolRoundTrip(t *testing.T) {
+	out := NewStreamOut(nil)
+	out.WriteListBool([]bool{true, false, true})
+
+	list, err := NewStreamIn(out.Bytes(), nil).ReadListBool()
+
+	if err != nil || !reflect.DeepEqual(list, []bool{true, false, true}) {
+		t.Errorf("Expected [true false true], got %v (error %v)", list, err)
+	}
+
+	// Any non-zero byte is read as true
+	list, err = NewStreamIn([]byte{0x02, 0x00, 0x00, 0x00, 0x02, 0x00}, nil).ReadListBool()
+
+	if err != nil || !reflect.DeepEqual(list, []bool{true, false}) {
+		t.Errorf("Expected [true false], got %v (error %v)", list, err)
+	}
+
+	_, err = NewStreamIn([]byte{0x04, 0x00, 0x00, 0x00, 0x01}, nil).ReadListBool()
+
+	if !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("Expected ErrInsufficientData for a length longer than the data, got %v", err)
+	}
+}
+
+func TestListLengthOverflow(t *testing.T) {
+	// Lengths whose size in bytes is exactly 2^32, which is 0 when computed in 32 bits
+	tests := []struct {
+		name   string
+		length uint32
+		read   func(stream *StreamIn) error
+	}{
+		{"ReadListUInt16LE", 0x80000000, func(stream *StreamIn) error { _, err := stream.ReadListUInt16LE(); return err }},
+		{"ReadListUInt32LE", 0x40000000, func(stream *StreamIn) error { _, err := stream.ReadListUInt32LE(); return err }},
+		{"ReadListUInt64LE", 0x20000000, func(stream *StreamIn) error { _, err := stream.ReadListUInt64LE(); return err }},
+	}
+
+	for _, test := range tests {
+		out := NewStreamOut(nil)
+		out.WriteUInt32LE(test.length)
+
+		err := test.read(NewStreamIn(out.Bytes(), nil))
+
+		var streamError *StreamError
+
+		if !errors.As(err, &streamError) || !errors.Is(err, ErrInsufficientData) {
+			t.Errorf("%s: expected a StreamError for insufficient data, got %v", test.name, err)
+			continue
+		}
+
+		if streamError.Expected != 1<<32 {
+			t.Errorf("%s: expected the check to need %d bytes, got %d", test.name, int64(1<<32), streamError.Expected)
+		}
+	}
+}
+
+func TestReadMapStructureRoundTrip(t *testing.T) {
+	expected := map[uint32]*testStructure{
+		1: newTestStructure(0x01, 100, "first"),
+		2: newTestStructure(0x02, 200, "second"),
+	}
+
+	// With and without structure headers
+	for _, server := range []*Server{newTestStructureServer(2), newTestStructureServer(3)} {
+		out := NewStreamOut(server)
+		out.WriteUInt32LE(uint32(len(expected)))
+
+		for _, key := range []uint32{1, 2} {
+			out.WriteUInt32LE(key)
+			out.WriteStructure(expected[key])
+		}
+
+		stream := NewStreamIn(out.Bytes(), server)
+
+		decoded, err := stream.ReadMapStructure(stream.ReadUInt32LE, func() StructureInterface {
+			return newTestStructure(0, 0, "")
+		})
+
+		if err != nil {
+			t.Fatalf("NEX version %d: ReadMapStructure failed: %v", server.NexVersion(), err)
+		}
+
+		if len(decoded) != len(expected) {
+			t.Fatalf("NEX version %d: expected %d entries, got %d", server.NexVersion(), len(expected), len(decoded))
+		}
+
+		for key, structure := range expected {
+			value, ok := decoded[key].(*testStructure)
+
+			if !ok {
+				t.Errorf("NEX version %d: missing structure for key %d", server.NexVersion(), key)
+				continue
+			}
+
+			if value.parent.flags != structure.parent.flags || value.id != structure.id || value.name != structure.name {
+				t.Errorf("NEX version %d: key %d decoded as flags %d id %d name %q", server.NexVersion(), key, value.parent.flags, value.id, value.name)
+			}
+		}
+	}
+}
+
+func TestFloatRoundTripBits(t *testing.T) {
+	// +inf, -inf, NaN with a payload, smallest denormal and -0
+	float32Bits := []uint32{0x7F800000, 0xFF800000, 0x7FC00001, 0x00000001, 0x80000000}
+	float64Bits := []uint64{0x7FF0000000000000, 0xFFF0000000000000, 0x7FF8000000000001, 0x0000000000000001, 0x8000000000000000}
+
+	for _, bits := range float32Bits {
+		out := NewStreamOut(nil)
+		out.WriteFloat32LE(math.Float32frombits(bits))
+		out.WriteFloat32BE(math.Float32frombits(bits))
+
+		if binary.LittleEndian.Uint32(out.Bytes()[0:4]) != bits || binary.BigEndian.Uint32(out.Bytes()[4:8]) != bits {
+			t.Errorf("float32 %08X written as % X", bits, out.Bytes())
+		}
+
+		in := NewStreamIn(out.Bytes(), nil)
+
+		if read := math.Float32bits(in.ReadFloat32LE()); read != bits {
+			t.Errorf("ReadFloat32LE: expected %08X, got %08X", bits, read)
+		}
+
+		if read := math.Float32bits(in.ReadFloat32BE()); read != bits {
+			t.Errorf("ReadFloat32BE: expected %08X, got %08X", bits, read)
+		}
+	}
+
+	for _, bits := range float64Bits {
+		out := NewStreamOut(nil)
+		out.WriteFloat64LE(math.Float64frombits(bits))
+		out.WriteFloat64BE(math.Float64frombits(bits))
+
+		if binary.LittleEndian.Uint64(out.Bytes()[0:8]) != bits || binary.BigEndian.Uint64(out.Bytes()[8:16]) != bits {
+			t.Errorf("float64 %016X written as % X", bits, out.Bytes())
+		}
+
+		in := NewStreamIn(out.Bytes(), nil)
+
+		if read := math.Float64bits(in.ReadFloat64LE()); read != bits {
+			t.Errorf("ReadFloat64LE: expected %016X, got %016X", bits, read)
+		}
+
+		if read := math.Float64bits(in.ReadFloat64BE()); read != bits {
+			t.Errorf("ReadFloat64BE: expected %016X, got %016X", bits, read)
+		}
+	}
+}
+
+func TestBufferSizedRoundTrip(t *testing.T) {
+	data := []byte{0x01, 0x02, 0x03, 0x04, 0x05}
+
+	for _, lengthSize := range []int{1, 2, 4} {
+		out := NewStreamOut(nil)
+
+		if err := out.WriteBufferSized(data, lengthSize); err != nil {
+			t.Fatalf("Length size %d: WriteBufferSized failed: %v", lengthSize, err)
+		}
+
+		if len(out.Bytes()) != lengthSize+len(data) {
+			t.Errorf("Length size %d: expected %d bytes, got %d", lengthSize, lengthSize+len(data), len(out.Bytes()))
+		}
+
+		read, err := NewStreamIn(out.Bytes(), nil).ReadBufferSized(lengthSize)
+
+		if err != nil || !bytes.Equal(read, data) {
+			t.Errorf("Length size %d: expected % X, got % X (error %v)", lengthSize, data, read, err)
+		}
+	}
+
+	if err := NewStreamOut(nil).WriteBufferSized(make([]byte, 256), 1); err == nil {
+		t.Error("Expected an error writing 256 bytes with a 1 byte length")
+	}
+
+	if err := NewStreamOut(nil).WriteBufferSized(data, 3); err == nil {
+		t.Error("Expected an error for a length size of 3")
+	}
+
+	if _, err := NewStreamIn([]byte{0x05, 0x01}, nil).ReadBufferSized(1); !errors.Is(err, ErrInsufficientData) {
+		t.Errorf("Expected ErrInsufficientData for a truncated buffer, got %v", err)
+	}
+}
@@ -1,6 +1,8 @@
 package nex
 
 import (
+	"fmt"
+	"math"
 	"reflect"
 
 	crunch "github.com/superwhiskers/crunch/v3"
@@ -24,6 +26,28 @@ func (stream *StreamOut) WriteUInt16LE(u16 uint16) {
 	stream.WriteU16LENext([]uint16{u16})
 }
 
+// WriteUInt24LE writes the lower 24 bits of a uint32 as LE
+func (stream *StreamOut) WriteUInt24LE(u24 uint32) {
+	stream.Grow(3)
+	stream.WriteBytesNext([]byte{byte(u24), byte(u24 >> 8), byte(u24 >> 16)})
+}
+
+// WriteUInt24BE writes the lower 24 bits of a uint32 as BE
+func (stream *StreamOut) WriteUInt24BE(u24 uint32) {
+	stream.Grow(3)
+	stream.WriteBytesNext([]byte{byte(u24 >> 16), byte(u24 >> 8), byte(u24)})
+}
+
+// WriteInt24LE writes the lower 24 bits of an int32 as LE
+func (stream *StreamOut) WriteInt24LE(s24 int32) {
+	stream.WriteUInt24LE(uint32(s24))
+}
+
+// WriteInt24BE writes the lower 24 bits of an int32 as BE
+func (stream *StreamOut) WriteInt24BE(s24 int32) {
+	stream.WriteUInt24BE(uint32(s24))
+}
+
 // WriteUInt32LE writes a uint32 as LE
 func (stream *StreamOut) WriteUInt32LE(u32 uint32) {
 	stream.Grow(4)
@@ -36,6 +60,39 @@ func (stream *StreamOut) WriteUInt64LE(u64 uint64) {
 	stream.WriteU64LENext([]uint64{u64})
 }
 
+// WriteFloat32LE writes a float32 as LE
+func (stream *StreamOut) WriteFloat32LE(f32 float32) {
+	stream.Grow(4)
+	stream.WriteU32LENext([]uint32{math.Float32bits(f32)})
+}
+
+// WriteFloat32BE writes a float32 as BE
+func (stream *StreamOut) WriteFloat32BE(f32 float32) {
+	stream.Grow(4)
+	stream.WriteU32BENext([]uint32{math.Float32bits(f32)})
+}
+
+// WriteFloat64LE writes a float64 as LE
+func (stream *StreamOut) WriteFloat64LE(f64 float64) {
+	stream.Grow(8)
+	stream.WriteU64LENext([]uint64{math.Float64bits(f64)})
+}
+
+// WriteFloat64BE writes a float64 as BE
+func (stream *StreamOut) WriteFloat64BE(f64 float64) {
+	stream.Grow(8)
+	stream.WriteU64BENext([]uint64{math.Float64bits(f64)})
+}
+
+// WriteBool writes a bool as a single byte
+func (stream *StreamOut) WriteBool(b bool) {
+	if b {
+		stream.WriteUInt8(1)
+	} else {
+		stream.WriteUInt8(0)
+	}
+}
+
 // WriteString writes a NEX string type
 func (stream *StreamOut) WriteString(str string) {
 	str = str + "\x00"
@@ -46,6 +103,51 @@ func (stream *StreamOut) WriteString(str string) {
 	stream.WriteBytesNext([]byte(str))
 }
 
+// WriteStringFixed writes the string as exactly size bytes with no length prefix or null terminator.
+// Shorter strings are padded with null bytes and longer strings are truncated
+func (stream *StreamOut) WriteStringFixed(str string, size int) {
+	data := make([]byte, size)
+	copy(data, str)
+
+	stream.Grow(int64(size))
+	stream.WriteBytesNext(data)
+}
+
+// WriteStationURL writes a StationURL as a NEX string type
+func (stream *StreamOut) WriteStationURL(stationURL *StationURL) {
+	stream.WriteString(stationURL.EncodeToString())
+}
+
+// WriteDateTime writes a NEX DateTime type
+func (stream *StreamOut) WriteDateTime(datetime *DateTime) {
+	stream.WriteUInt64LE(datetime.Value())
+}
+
+// WritePID writes a NEX PID type. The width is chosen the same way as StreamIn.ReadPID, based on the stream server rather than the PID.
+// 64-bit PIDs written to a 32-bit stream are written as their LegacyValue
+func (stream *StreamOut) WritePID(pid *PID) {
+	if Uses64BitPIDs(stream.Server) {
+		stream.WriteUInt64LE(pid.Value())
+	} else {
+		stream.WriteUInt32LE(pid.LegacyValue())
+	}
+}
+
+// WriteVariant writes a Variant type with the given type ID. The value must be of the type the type ID is read as by StreamIn.ReadVariant.
+// An error is returned for unknown type IDs
+func (stream *StreamOut) WriteVariant(typeID uint8, value interface{}) error {
+	variant, err := lookupVariantType(typeID)
+
+	if err != nil {
+		return err
+	}
+
+	stream.WriteUInt8(typeID)
+	variant.writer(stream, value)
+
+	return nil
+}
+
 // WriteBuffer writes a NEX Buffer type
 func (stream *StreamOut) WriteBuffer(data []byte) {
 	dataLength := len(data)
@@ -55,12 +157,60 @@ func (stream *StreamOut) WriteBuffer(data []byte) {
 	stream.WriteBytesNext(data)
 }
 
-// WriteStructure writes a nex Structure type
+// WriteQBuffer writes a NEX qBuffer type, which is a buffer with a uint16 length
+func (stream *StreamOut) WriteQBuffer(data []byte) {
+	dataLength := len(data)
+
+	stream.WriteUInt16LE(uint16(dataLength))
+	stream.Grow(int64(dataLength))
+	stream.WriteBytesNext(data)
+}
+
+// WriteBufferSized writes a buffer with a length of lengthSize bytes, which must be 1, 2 or 4.
+// An error is returned if the length size is invalid or the data is too long for it
+func (stream *StreamOut) WriteBufferSized(data []byte, lengthSize int) error {
+	dataLength := len(data)
+
+	if lengthSize != 1 && lengthSize != 2 && lengthSize != 4 {
+		return fmt.Errorf("[StreamOut] Invalid buffer length size %d", lengthSize)
+	}
+
+	if uint64(dataLength) >= uint64(1)<<(8*uint(lengthSize)) {
+		return fmt.Errorf("[StreamOut] Buffer of %d bytes is too long for a length size of %d", dataLength, lengthSize)
+	}
+
+	switch lengthSize {
+	case 1:
+		stream.WriteUInt8(uint8(dataLength))
+	case 2:
+		stream.WriteUInt16LE(uint16(dataLength))
+	case 4:
+		stream.WriteUInt32LE(uint32(dataLength))
+	}
+
+	stream.Grow(int64(dataLength))
+	stream.WriteBytesNext(data)
+
+	return nil
+}
+
+// WriteStructure writes a nex Structure type. The structures in its Hierarchy are written first, each with their own header,
+// matching the way StreamIn.ReadStructure reads them. The header version is the StructureVersion of a VersionedStructure, and 1 otherwise
 func (stream *StreamOut) WriteStructure(structure StructureInterface) {
+	for _, class := range structure.Hierarchy() {
+		stream.WriteStructure(class)
+	}
+
 	content := structure.Bytes(NewStreamOut(stream.Server))
 
-	if stream.Server.NexVersion() >= 3 {
-		stream.WriteUInt8(1) // version
+	if UsesStructureHeader(stream.Server) {
+		version := uint8(1)
+
+		if versioned, ok := structure.(VersionedStructure); ok {
+			version = versioned.StructureVersion()
+		}
+
+		stream.WriteUInt8(version)
 		stream.WriteUInt32LE(uint32(len(content)))
 	}
 
@@ -77,6 +227,15 @@ func (stream *StreamOut) WriteListUInt8(list []uint8) {
 	}
 }
 
+// WriteListBool writes a list of bool types
+func (stream *StreamOut) WriteListBool(list []bool) {
+	stream.WriteUInt32LE(uint32(len(list)))
+
+	for i := 0; i < len(list); i++ {
+		stream.WriteBool(list[i])
+	}
+}
+
 // WriteListUInt16LE writes a list of uint16 types
 func (stream *StreamOut) WriteListUInt16LE(list []uint16) {
 	stream.WriteUInt32LE(uint32(len(list)))
@@ -86,6 +245,24 @@ func (stream *StreamOut) WriteListUInt16LE(list []uint16) {
 	}
 }
 
+// WriteListUInt24LE writes a list of 24 bit little endian unsigned integers
+func (stream *StreamOut) WriteListUInt24LE(list []uint32) {
+	stream.WriteUInt32LE(uint32(len(list)))
+
+	for i := 0; i < len(list); i++ {
+		stream.WriteUInt24LE(list[i])
+	}
+}
+
+// WriteListUInt24BE writes a list of 24 bit big endian unsigned integers
+func (stream *StreamOut) WriteListUInt24BE(list []uint32) {
+	stream.WriteUInt32LE(uint32(len(list)))
+
+	for i := 0; i < len(list); i++ {
+		stream.WriteUInt24BE(list[i])
+	}
+}
+
 // WriteListUInt32LE writes a list of uint32 types
 func (stream *StreamOut) WriteListUInt32LE(list []uint32) {
 	stream.WriteUInt32LE(uint32(len(list)))
@@ -0,0 +1,81 @@
+package nex
+
+import (
+	"fmt"
+	"sync"
+)
+
+// variantType holds the functions used to read and write the value of a Variant type ID
+type variantType struct {
+	reader func(*StreamIn) (interface{}, error)
+	writer func(*StreamOut, interface{})
+}
+
+var variantTypes = map[uint8]variantType{
+	0: { // null
+		reader: func(stream *StreamIn) (interface{}, error) { return nil, nil },
+		writer: func(stream *StreamOut, value interface{}) {},
+	},
+	1: { // sint64
+		reader: fixedSizeVariantReader(8, func(stream *StreamIn) interface{} { return int64(stream.ReadUInt64LE()) }),
+		writer: func(stream *StreamOut, value interface{}) { stream.WriteUInt64LE(uint64(value.(int64))) },
+	},
+	2: { // double
+		reader: fixedSizeVariantReader(8, func(stream *StreamIn) interface{} { return stream.ReadFloat64LE() }),
+		writer: func(stream *StreamOut, value interface{}) { stream.WriteFloat64LE(value.(float64)) },
+	},
+	3: { // bool
+		reader: fixedSizeVariantReader(1, func(stream *StreamIn) interface{} { return stream.ReadBool() }),
+		writer: func(stream *StreamOut, value interface{}) { stream.WriteBool(value.(bool)) },
+	},
+	4: { // string
+		reader: func(stream *StreamIn) (interface{}, error) { return stream.ReadString() },
+		writer: func(stream *StreamOut, value interface{}) { stream.WriteString(value.(string)) },
+	},
+	5: { // datetime
+		reader: fixedSizeVariantReader(8, func(stream *StreamIn) interface{} { return stream.ReadDateTime() }),
+		writer: func(stream *StreamOut, value interface{}) { stream.WriteDateTime(value.(*DateTime)) },
+	},
+	6: { // uint64
+		reader: fixedSizeVariantReader(8, func(stream *StreamIn) interface{} { return stream.ReadUInt64LE() }),
+		writer: func(stream *StreamOut, value interface{}) { stream.WriteUInt64LE(value.(uint64)) },
+	},
+}
+
+var variantTypesMutex sync.RWMutex
+
+// RegisterVariantType registers the functions used to read and write Variant values with the given type ID.
+// This allows supporting type IDs used by some titles beyond the 7 standard ones. Registering an existing type ID replaces it.
+// The writer is given the value passed to StreamOut.WriteVariant, and may panic if it is not of the expected type
+func RegisterVariantType(typeID uint8, reader func(*StreamIn) (interface{}, error), writer func(*StreamOut, interface{})) {
+	variantTypesMutex.Lock()
+	defer variantTypesMutex.Unlock()
+
+	variantTypes[typeID] = variantType{reader: reader, writer: writer}
+}
+
+// fixedSizeVariantReader returns a Variant reader which checks that the stream has the given number of bytes left before reading
+func fixedSizeVariantReader(size int64, read func(*StreamIn) interface{}) func(*StreamIn) (interface{}, error) {
+	return func(stream *StreamIn) (interface{}, error) {
+		err := stream.checkRemaining("ReadVariant", size)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return read(stream), nil
+	}
+}
+
+func lookupVariantType(typeID uint8) (variantType, error) {
+	variantTypesMutex.RLock()
+	defer variantTypesMutex.RUnlock()
+
+	variant, ok := variantTypes[typeID]
+
+	if !ok {
+		return variantType{}, fmt.Errorf("[Variant] Unknown Variant type ID %d", typeID)
+	}
+
+	return variant, nil
+}
@@ -0,0 +1,78 @@
+package nex
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegisterVariantType(t *testing.T) {
+	const qBufferTypeID = 0x80
+
+	RegisterVariantType(qBufferTypeID, func(stream *StreamIn) (interface{}, error) {
+		return stream.ReadQBuffer()
+	}, func(stream *StreamOut, value interface{}) {
+		stream.WriteQBuffer(value.([]byte))
+	})
+
+	defer func() {
+		variantTypesMutex.Lock()
+		delete(variantTypes, qBufferTypeID)
+		variantTypesMutex.Unlock()
+	}()
+
+	data := []byte{0x01, 0x02, 0x03}
+
+	out := NewStreamOut(nil)
+
+	if err := out.WriteVariant(qBufferTypeID, data); err != nil {
+		t.Fatalf("Failed to write the registered Variant type: %v", err)
+	}
+
+	if err := out.WriteVariant(4, "standard"); err != nil {
+		t.Fatalf("Failed to write a standard Variant type: %v", err)
+	}
+
+	in := NewStreamIn(out.Bytes(), nil)
+
+	value, err := in.ReadVariant()
+
+	if err != nil {
+		t.Fatalf("Failed to read the registered Variant type: %v", err)
+	}
+
+	if read, ok := value.([]byte); !ok || !bytes.Equal(read, data) {
+		t.Errorf("Expected % X, got %#v", data, value)
+	}
+
+	value, err = in.ReadVariant()
+
+	if err != nil || value != "standard" {
+		t.Errorf("Expected the standard string Variant after the registered one, got %#v (error %v)", value, err)
+	}
+}
+
+func TestUnknownVariantType(t *testing.T) {
+	if err := NewStreamOut(nil).WriteVariant(0xFE, nil); err == nil || !strings.Contains(err.Error(), "254") {
+		t.Errorf("Expected an error naming the unknown type ID when writing, got %v", err)
+	}
+
+	_, err := NewStreamIn([]byte{0xFE, 0x00, 0x00}, nil).ReadVariant()
+
+	if err == nil || !strings.Contains(err.Error(), "254") {
+		t.Errorf("Expected an error naming the unknown type ID when reading, got %v", err)
+	}
+}
+
+func TestTruncatedVariant(t *testing.T) {
+	for _, typeID := range []uint8{1, 2, 3, 5, 6} {
+		_, err := NewStreamIn([]byte{typeID}, nil).ReadVariant()
+
+		var streamError *StreamError
+
+		if !errors.As(err, &streamError) || !errors.Is(err, ErrInsufficientData) {
+			t.Errorf("Expected a StreamError for a truncated Variant of type %d, got %v", typeID, err)
+		}
+	}
+}